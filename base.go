@@ -0,0 +1,603 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+
+	. "github.com/chefsgo/base"
+)
+
+type (
+	// moduleBase 包装驱动的DataBase
+	// 校验等公共的处理放在这一层，驱动不需要关心
+	moduleBase struct {
+		name      string
+		config    Config
+		base      DataBase
+		lastError error
+
+		//事务中的触发器，提交后再分发
+		//marks 为每一层开始时的触发器数量，回滚保存点时丢弃之后的
+		marks   []int
+		pending []pendingEvent
+
+		//只读副本，第一次查询时选择
+		router  *replicaRouter
+		replica DataBase
+
+		ctx context.Context
+	}
+	// moduleTable 等只实现返回错误的版本，DataTable 由 checkedTable 包装
+	moduleTable struct {
+		base  *moduleBase
+		name  string
+		table CheckedTable
+	}
+	moduleView struct {
+		base *moduleBase
+		name string
+		view CheckedView
+	}
+	moduleModel struct {
+		base  *moduleBase
+		name  string
+		model CheckedModel
+	}
+)
+
+func (this *moduleBase) Close() error {
+	if this.replica != nil {
+		this.replica.Close()
+	}
+	return this.base.Close()
+}
+
+// Erred 先返回模块层的错误，再返回副本和驱动的错误
+// 所有的错误都会被清掉
+func (this *moduleBase) Erred() error {
+	errs := []error{this.lastError}
+	this.lastError = nil
+	if this.replica != nil {
+		errs = append(errs, this.replica.Erred())
+	}
+	errs = append(errs, this.base.Erred())
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithContext 设置上下文，主库和副本都会使用
+func (this *moduleBase) WithContext(ctx context.Context) DataBase {
+	this.ctx = ctx
+	this.base.WithContext(ctx)
+	if this.replica != nil {
+		this.replica.WithContext(ctx)
+	}
+	return this
+}
+
+// reader 查询使用的DataBase
+// 事务中或是强制走主库的，以及没有副本的，都用主库
+func (this *moduleBase) reader(primary bool) DataBase {
+	if primary || this.Depth() > 0 || this.router == nil {
+		return this.base
+	}
+	if this.replica == nil {
+		connect := this.router.pick()
+		if connect == nil {
+			return this.base
+		}
+		this.replica = connect.Base()
+		if this.ctx != nil {
+			this.replica.WithContext(this.ctx)
+		}
+	}
+	return this.replica
+}
+
+func (this *moduleBase) Table(name string) DataTable {
+	table := &moduleTable{this, name, this.base.Table(name).Checked()}
+	return &checkedTable{table, &this.lastError}
+}
+func (this *moduleBase) View(name string) DataView {
+	view := &moduleView{this, name, this.base.View(name).Checked()}
+	return &checkedView{view, &this.lastError}
+}
+func (this *moduleBase) Model(name string) DataModel {
+	model := &moduleModel{this, name, this.base.Model(name).Checked()}
+	return &checkedModel{model, &this.lastError}
+}
+
+// Serial 交给连接配置的序列实现
+func (this *moduleBase) Serial(key string, start, step int64) int64 {
+	provider, err := module.serialing(this.config)
+	if err != nil {
+		this.lastError = err
+		return 0
+	}
+	value, err := provider.Serial(this.name, this.base, key, start, step)
+	if err != nil {
+		this.lastError = err
+		return 0
+	}
+	return value
+}
+func (this *moduleBase) Break(key string) {
+	provider, err := module.serialing(this.config)
+	if err == nil {
+		err = provider.Break(this.name, this.base, key)
+	}
+	if err != nil {
+		this.lastError = err
+	}
+}
+
+func (this *moduleBase) Begin() (*sql.Tx, error) {
+	tx, err := this.base.Begin()
+	if err == nil {
+		this.marks = append(this.marks, len(this.pending))
+	}
+	return tx, err
+}
+
+// Submit 最外层提交成功后，分发事务中的触发器
+// 内层的只是释放保存点，触发器留到最外层
+// 最外层提交失败的事务已经结束，和 Cancel 一样丢弃所有的触发器
+func (this *moduleBase) Submit() error {
+	err := this.base.Submit()
+	if err != nil {
+		if len(this.marks) <= 1 {
+			this.marks, this.pending = nil, nil
+		}
+		return err
+	}
+	if len(this.marks) > 1 {
+		this.marks = this.marks[:len(this.marks)-1]
+		return nil
+	}
+
+	pending := this.pending
+	this.marks, this.pending = nil, nil
+	for _, item := range pending {
+		this.deliver(item)
+	}
+	return nil
+}
+
+// Cancel 丢弃这一层的触发器
+func (this *moduleBase) Cancel() error {
+	if count := len(this.marks); count > 0 {
+		this.pending = this.pending[:this.marks[count-1]]
+		this.marks = this.marks[:count-1]
+	}
+	if len(this.marks) == 0 {
+		this.pending = nil
+	}
+	return this.base.Cancel()
+}
+
+// Depth 事务的层数
+func (this *moduleBase) Depth() int {
+	return len(this.marks)
+}
+
+// Transaction 在事务中执行，函数拿到的是包装后的DataBase
+// 每次重试都重新收集触发器，提交成功后才分发
+// 已经在事务中的用保存点执行，出错只回滚到保存点，不再重试
+func (this *moduleBase) Transaction(call func(DataBase) error, opts ...TxOption) error {
+	if this.Depth() > 0 {
+		begin := func(TxOption) error {
+			_, err := this.Begin()
+			return err
+		}
+		return module.transacting(this, begin, call, txOption(opts...))
+	}
+
+	pending := []pendingEvent{}
+	defer func() {
+		this.marks, this.pending = nil, nil
+	}()
+
+	err := this.base.Transaction(func(DataBase) error {
+		this.marks, this.pending = []int{0}, nil
+		err := call(this)
+		pending = this.pending
+		return err
+	}, opts...)
+	if err != nil {
+		return classify(err)
+	}
+
+	this.marks, this.pending = nil, nil
+	for _, item := range pending {
+		this.deliver(item)
+	}
+	return nil
+}
+
+// atomic 开启了发件箱又不在事务中的，写入和发件箱放在同一个事务里
+// 发件箱写入失败的，数据也一起回滚
+func (this *moduleBase) atomic(call func() error) error {
+	if this.Depth() > 0 || module.outboxTable(this.config) == "" {
+		return call()
+	}
+	return this.Transaction(func(DataBase) error {
+		return call()
+	})
+}
+
+// trigger 触发事件
+// 开启了发件箱的先写入发件箱，写入失败返回错误
+// 事务中的事件不管监听是什么模式，都等最外层提交后再分发
+func (this *moduleBase) trigger(name, table string, before, after Map) error {
+	event := Event{
+		Name: name, Base: this.name, Table: table,
+		Before: before, After: after,
+	}
+
+	id, err := this.outbox(event)
+	if err != nil {
+		return err
+	}
+
+	item := pendingEvent{event, id}
+	if this.Depth() > 0 {
+		this.pending = append(this.pending, item)
+	} else {
+		this.deliver(item)
+	}
+	return nil
+}
+
+// deliver 分发事件，完成后从发件箱删除
+func (this *moduleBase) deliver(item pendingEvent) {
+	module.Trigger(item.event)
+	this.delivered(item.id)
+}
+
+//---------------------------- table ----------------------------
+
+// Create 创建前按字段定义校验，严格模式的先检查字段
+func (this *moduleTable) Create(data Map) (Map, error) {
+	if err := this.base.stricts(this.name, data); err != nil {
+		return nil, err
+	}
+	value, err := module.Validate(this.name, data, false)
+	if err != nil {
+		return nil, err
+	}
+	var item Map
+	err = this.base.atomic(func() error {
+		item, err = this.table.Create(value)
+		if err != nil {
+			return classify(err)
+		}
+		return this.base.trigger(CreateTrigger, this.name, nil, item)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// Change 修改前按字段定义校验，只校验传入的字段
+func (this *moduleTable) Change(item Map, data Map) (Map, error) {
+	if err := this.base.stricts(this.name, data); err != nil {
+		return nil, err
+	}
+	value, err := module.Validate(this.name, data, true)
+	if err != nil {
+		return nil, err
+	}
+	var after Map
+	err = this.base.atomic(func() error {
+		after, err = this.table.Change(item, value)
+		if err != nil {
+			return classify(err)
+		}
+		return this.base.trigger(ChangeTrigger, this.name, item, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// Remove 开启了软删除的只更新删除字段
+// 有关联需要处理的，在事务里先处理关联
+func (this *moduleTable) Remove(args ...Any) (Map, error) {
+	args, _ = routeScoping(args)
+	args, _ = includeScoping(args)
+	if err := this.base.strict(this.name, args); err != nil {
+		return nil, err
+	}
+	if module.cascading(this.name) == false {
+		var item Map
+		err := this.base.atomic(func() error {
+			var err error
+			item, err = this.removing(args...)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return item, nil
+	}
+
+	var item Map
+	err := this.base.Transaction(func(DataBase) error {
+		scoped, err := module.softScoping(this.name, args)
+		if err != nil {
+			return err
+		}
+		before, err := this.table.First(scoped...)
+		if err != nil {
+			return err
+		}
+		if err := module.removing(this.base, this.name, before); err != nil {
+			return err
+		}
+		item, err = this.removing(Map{this.key(): before[this.key()]})
+		return err
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+	return item, nil
+}
+
+// removing 删除并触发
+func (this *moduleTable) removing(args ...Any) (Map, error) {
+	item, err := module.softRemoving(this.name, this.table, args...)
+	if err != nil {
+		return nil, classify(err)
+	}
+	if err := this.base.trigger(RemoveTrigger, this.name, item, nil); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// Recover 恢复软删除的数据
+func (this *moduleTable) Recover(args ...Any) (Map, error) {
+	args, _ = routeScoping(args)
+	if err := this.base.strict(this.name, args); err != nil {
+		return nil, err
+	}
+	var after Map
+	err := this.base.atomic(func() error {
+		before, item, err := module.softRecovering(this.name, this.table, args...)
+		if err != nil {
+			return classify(err)
+		}
+		after = item
+		return this.base.trigger(RecoverTrigger, this.name, before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// 写入都走主库
+func (this *moduleTable) Update(sets Map, args ...Any) (int64, error) {
+	args, _ = routeScoping(args)
+	if err := this.base.strict(this.name, args); err != nil {
+		return 0, err
+	}
+	if err := this.base.stricts(this.name, sets); err != nil {
+		return 0, err
+	}
+	count, err := this.table.Update(sets, args...)
+	return count, classify(err)
+}
+func (this *moduleTable) Delete(args ...Any) (int64, error) {
+	args, _ = routeScoping(args)
+	if err := this.base.strict(this.name, args); err != nil {
+		return 0, err
+	}
+	count, err := this.table.Delete(args...)
+	return count, classify(err)
+}
+
+// Entity 开启了软删除的，已删除的数据返回 ErrNotFound
+func (this *moduleTable) Entity(id Any) (Map, error) {
+	return this.First(Map{this.key(): id})
+}
+
+// 查询都会排除软删除的数据，没有强制主库的走副本
+func (this *moduleTable) Count(args ...Any) (float64, error) {
+	table, args, err := this.reading(args)
+	if err != nil {
+		return 0, err
+	}
+	count, err := table.Count(args...)
+	return count, classify(err)
+}
+
+// First, Query, Limit 可以用 Include 预加载关联
+func (this *moduleTable) First(args ...Any) (Map, error) {
+	args, includes := includeScoping(args)
+	table, args, err := this.reading(args)
+	if err != nil {
+		return nil, err
+	}
+	item, err := table.First(args...)
+	if err != nil {
+		return nil, classify(err)
+	}
+	if err := module.preloading(this.base, this.name, []Map{item}, includes); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+func (this *moduleTable) Query(args ...Any) ([]Map, error) {
+	args, includes := includeScoping(args)
+	table, args, err := this.reading(args)
+	if err != nil {
+		return nil, err
+	}
+	items, err := table.Query(args...)
+	if err != nil {
+		return items, classify(err)
+	}
+	if err := module.preloading(this.base, this.name, items, includes); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+func (this *moduleTable) Limit(offset, limit Any, args ...Any) (int64, []Map, error) {
+	args, includes := includeScoping(args)
+	table, args, err := this.reading(args)
+	if err != nil {
+		return 0, nil, err
+	}
+	total, items, err := table.Limit(offset, limit, args...)
+	if err != nil {
+		return total, items, classify(err)
+	}
+	if err := module.preloading(this.base, this.name, items, includes); err != nil {
+		return 0, nil, err
+	}
+	return total, items, nil
+}
+func (this *moduleTable) Group(field string, args ...Any) ([]Map, error) {
+	if err := this.base.strictField(this.name, field); err != nil {
+		return nil, err
+	}
+	table, args, err := this.reading(args)
+	if err != nil {
+		return nil, err
+	}
+	items, err := table.Group(field, args...)
+	return items, classify(err)
+}
+
+// reading 查询使用的表和处理后的参数
+func (this *moduleTable) reading(args []Any) (CheckedTable, []Any, error) {
+	args, _ = includeScoping(args)
+	args, primary := routeScoping(args)
+	if err := this.base.strict(this.name, args); err != nil {
+		return nil, nil, err
+	}
+	args, err := module.softScoping(this.name, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	base := this.base.reader(primary)
+	if base == this.base.base {
+		return this.table, args, nil
+	}
+	return base.Table(this.name).Checked(), args, nil
+}
+
+// key 表的主键
+func (this *moduleTable) key() string {
+	return module.tableKey(this.name)
+}
+
+//---------------------------- view & model ----------------------------
+
+// 视图和模型都是只读的，没有强制主库的走副本
+func (this *moduleView) Count(args ...Any) (float64, error) {
+	view, args, err := this.reading(args)
+	if err != nil {
+		return 0, err
+	}
+	count, err := view.Count(args...)
+	return count, classify(err)
+}
+func (this *moduleView) First(args ...Any) (Map, error) {
+	view, args, err := this.reading(args)
+	if err != nil {
+		return nil, err
+	}
+	item, err := view.First(args...)
+	return item, classify(err)
+}
+func (this *moduleView) Query(args ...Any) ([]Map, error) {
+	view, args, err := this.reading(args)
+	if err != nil {
+		return nil, err
+	}
+	items, err := view.Query(args...)
+	return items, classify(err)
+}
+func (this *moduleView) Limit(offset, limit Any, args ...Any) (int64, []Map, error) {
+	view, args, err := this.reading(args)
+	if err != nil {
+		return 0, nil, err
+	}
+	total, items, err := view.Limit(offset, limit, args...)
+	return total, items, classify(err)
+}
+func (this *moduleView) Group(field string, args ...Any) ([]Map, error) {
+	if err := this.base.strictField(this.name, field); err != nil {
+		return nil, err
+	}
+	view, args, err := this.reading(args)
+	if err != nil {
+		return nil, err
+	}
+	items, err := view.Group(field, args...)
+	return items, classify(err)
+}
+
+func (this *moduleView) reading(args []Any) (CheckedView, []Any, error) {
+	args, primary := routeScoping(args)
+	if err := this.base.strict(this.name, args); err != nil {
+		return nil, nil, err
+	}
+	base := this.base.reader(primary)
+	if base == this.base.base {
+		return this.view, args, nil
+	}
+	return base.View(this.name).Checked(), args, nil
+}
+
+// 模型字段引用的表和视图，每个字段批量查询一次
+func (this *moduleModel) First(args ...Any) (Map, error) {
+	model, args, err := this.reading(args)
+	if err != nil {
+		return nil, err
+	}
+	item, err := model.First(args...)
+	if err != nil {
+		return nil, classify(err)
+	}
+	if err := module.referencing(this.base, this.name, []Map{item}); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+func (this *moduleModel) Query(args ...Any) ([]Map, error) {
+	model, args, err := this.reading(args)
+	if err != nil {
+		return nil, err
+	}
+	items, err := model.Query(args...)
+	if err != nil {
+		return items, classify(err)
+	}
+	if err := module.referencing(this.base, this.name, items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (this *moduleModel) reading(args []Any) (CheckedModel, []Any, error) {
+	args, primary := routeScoping(args)
+	if err := this.base.strict(this.name, args); err != nil {
+		return nil, nil, err
+	}
+	base := this.base.reader(primary)
+	if base == this.base.base {
+		return this.model, args, nil
+	}
+	return base.Model(this.name).Checked(), args, nil
+}
@@ -16,6 +16,14 @@ type (
 		Key     string `json:"key"`
 		Fields  Vars   `json:"fields"`
 		Setting Map    `toml:"setting"`
+
+		//索引，唯一约束和外键
+		Indexes []Index   `json:"indexes"`
+		Uniques []Index   `json:"uniques"`
+		Foreign []Foreign `json:"foreign"`
+
+		//关联，key为查询结果里的字段名
+		Relates map[string]Relate `json:"relates"`
 	}
 	View struct {
 		Name    string `json:"name"`
@@ -35,8 +43,29 @@ type (
 		Setting Map    `toml:"setting"`
 	}
 
+	// Relate 关联，Type 为 RelateBelongs, RelateMany, RelateManyMany
+	// belongs 为当前表的 Field 引用 Table 的 Key，Key 为空时为 Table 的主键
+	// many 为 Table 的 Key 引用当前表的 Field，Field 为空时为当前表的主键
+	// manymany 为通过中间表 Through，Through 的 Field 引用当前表的主键，Key 引用 Table 的主键
+	// Status 为删除时的处理，RelateCascade 级联删除，RelateRestrict 有关联数据时不能删除
 	Relate struct {
 		Key, Field, Status, Type string
+		Table, Through           string
+	}
+
+	// Index 索引，可以是多个字段，Name 为空时按表名和字段生成
+	Index struct {
+		Name   string   `json:"name"`
+		Fields []string `json:"fields"`
+	}
+	// Foreign 外键，Fields 引用 Table 的 Keys，Keys 为空时引用主键
+	// OnDelete 为 CASCADE, SET NULL, RESTRICT 等
+	Foreign struct {
+		Name     string   `json:"name"`
+		Fields   []string `json:"fields"`
+		Table    string   `json:"table"`
+		Keys     []string `json:"keys"`
+		OnDelete string   `json:"ondelete"`
 	}
 )
 
@@ -44,6 +73,10 @@ func (this *Module) Table(name string, config Table, override bool) {
 	this.mutex.Lock()
 	defer this.mutex.Unlock()
 
+	if err := relateChecking(name, config); err != nil {
+		panic(err.Error())
+	}
+
 	if override {
 		this.tables[name] = config
 	} else {
@@ -59,6 +92,8 @@ func (this *Module) TableConfig(name string) *Table {
 			config.Name, config.Text,
 			config.Schema, config.Table,
 			config.Key, config.Fields, config.Setting,
+			config.Indexes, config.Uniques, config.Foreign,
+			config.Relates,
 		}
 	}
 	return nil
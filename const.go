@@ -14,5 +14,26 @@ const (
 )
 
 var (
-	errInvalidDataConnection = errors.New("Invalid data connection.")
+	errInvalidDataConnection = errors.New("Invalid data connection")
+
+	// ErrNotFound 没有找到数据
+	ErrNotFound = errors.New("Data not found")
+	// ErrConflict 数据冲突，ErrDuplicate, ErrDeadlock, ErrSerialization 都属于冲突
+	ErrConflict = errors.New("Data conflict")
+	// ErrDuplicate 主键或唯一索引重复
+	ErrDuplicate error = &dataError{ErrConflict, errors.New("Duplicate data")}
+	// ErrDeadlock 死锁或是锁等待失败，可以重试
+	ErrDeadlock error = &dataError{ErrConflict, errors.New("Data deadlock")}
+	// ErrSerialization 事务序列化失败，可以重试
+	ErrSerialization error = &dataError{ErrConflict, errors.New("Data serialization failure")}
+	// ErrConstraint 违反非空、外键、检查等约束
+	ErrConstraint = errors.New("Data constraint violation")
+	// ErrInvalidQuery 查询条件或是SQL无效
+	ErrInvalidQuery = errors.New("Invalid data query")
+	// ErrValidation 数据校验失败，具体的字段用 errors.As 拿 *ValidationError
+	ErrValidation = errors.New("Invalid data")
+	// ErrTimeout 执行超时
+	ErrTimeout = errors.New("Data timeout")
+	// ErrConnectionLost 连接断开或是没有打开
+	ErrConnectionLost = errors.New("Data connection lost")
 )
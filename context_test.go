@@ -0,0 +1,85 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/chefsgo/base"
+)
+
+func TestContextCancel(t *testing.T) {
+	memorySeed(t, memoryTesting(t), "test_context", Map{"name": "a"})
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, done := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer done()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want error
+	}{
+		{"canceled", canceled, context.Canceled},
+		{"expired", expired, ErrTimeout},
+	}
+
+	for _, test := range tests {
+		db := memoryTesting(t).WithContext(test.ctx)
+		table := db.Table("test_context").Checked()
+
+		if _, err := table.Query(); errors.Is(err, test.want) == false {
+			t.Errorf("%s query: got %v, want %v", test.name, err, test.want)
+		}
+		if _, err := table.Create(Map{"name": "b"}); errors.Is(err, test.want) == false {
+			t.Errorf("%s create: got %v, want %v", test.name, err, test.want)
+		}
+		db.Close()
+	}
+
+	if count := memoryTesting(t).Table("test_context").Count(); count != 1 {
+		t.Errorf("count: got %v, want 1", count)
+	}
+}
+
+func TestContextTimeout(t *testing.T) {
+	tests := []struct {
+		setting Any
+		want    time.Duration
+	}{
+		{"50ms", time.Millisecond * 50},
+		{100, time.Millisecond * 100},
+		{int64(100), time.Millisecond * 100},
+		{time.Second, time.Second},
+		{"bad", 0},
+		{nil, 0},
+	}
+	for _, test := range tests {
+		if got := Timeout(Config{Setting: Map{"timeout": test.setting}}); got != test.want {
+			t.Errorf("%#v: got %v, want %v", test.setting, got, test.want)
+		}
+	}
+
+	ctx, cancel := WithTimeout(context.Background(), Config{Setting: Map{"timeout": "1h"}})
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); ok == false || time.Until(deadline) < time.Minute*59 {
+		t.Errorf("timeout: got %v %v", deadline, ok)
+	}
+
+	//上下文已经有更早的截止时间的，以上下文为准
+	early, done := context.WithTimeout(context.Background(), time.Second)
+	defer done()
+	ctx, cancel = WithTimeout(early, Config{Setting: Map{"timeout": "1h"}})
+	defer cancel()
+	if deadline, _ := ctx.Deadline(); time.Until(deadline) > time.Second {
+		t.Errorf("early deadline: got %v", deadline)
+	}
+
+	ctx, cancel = WithTimeout(context.Background(), Config{})
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("no timeout: got a deadline")
+	}
+}
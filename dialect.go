@@ -0,0 +1,350 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/chefsgo/base"
+)
+
+func init() {
+	module.Dialect("postgres", &postgresDialect{}, false)
+	module.Dialect("mysql", &mysqlDialect{}, false)
+	module.Dialect("sqlite", &sqliteDialect{}, false)
+}
+
+const (
+	CastInt   = "int"
+	CastFloat = "float"
+	CastText  = "text"
+)
+
+type (
+	// Dialect SQL方言
+	// 驱动注册时用和驱动相同的名称注册方言，Parse 就会按方言生成SQL
+	// 数组下标和postgres一样，从1开始
+	Dialect interface {
+		// Quote 包裹字段名或表名
+		Quote(name string) string
+		// Placeholder 参数占位符，index 从1开始
+		Placeholder(index int) string
+		// Json 取json字段的子字段，返回文本
+		Json(field, key string) string
+		// Element 取数组字段的元素
+		Element(field string, index int) string
+		// Any 数组字段包含某个值
+		Any(field, value string) string
+		// Contains 数组字段包含全部的值
+		Contains(field string, values []string) string
+		// Contained 数组字段的所有值都在给定的值中
+		Contained(field string, values []string) string
+		// Random 随机排序
+		Random() string
+		// Cast 类型转换，kind 为 CastInt, CastFloat, CastText
+		Cast(expr, kind string) string
+		// Pattern 把文本转义成匹配的参数，mode 为 LikeFull, LikeLeft, LikeRight
+		Pattern(text, mode string, insensitive bool) string
+		// Like 匹配，value 为 Pattern 生成的参数的占位符
+		// insensitive 为 true 时不区分大小写，支持的方言用 ILIKE
+		Like(field, value string, insensitive bool) string
+		// Collate 按排序规则排序
+		Collate(field, collation string) string
+		// Order 排序，nulls 为 NullsFirst, NullsLast 或空
+		Order(field string, desc bool, nulls string) string
+	}
+
+	// defaultDialect 默认方言，保持原来的输出
+	// 字段包裹成 $field$，参数使用问号，其它按postgres语法，由驱动自行处理
+	defaultDialect struct{}
+	// postgresDialect postgres方言
+	postgresDialect struct{}
+	// mysqlDialect mysql方言，数组以json保存
+	mysqlDialect struct{}
+	// sqliteDialect sqlite方言，数组以json保存，需要JSON1扩展
+	sqliteDialect struct{}
+)
+
+// Dialect 注册方言
+func (this *Module) Dialect(name string, dialect Dialect, override bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if dialect == nil {
+		panic("Invalid data dialect: " + name)
+	}
+
+	if override {
+		this.dialects[name] = dialect
+	} else {
+		if _, ok := this.dialects[name]; ok == false {
+			this.dialects[name] = dialect
+		}
+	}
+}
+
+// DialectConfig 获取方言，没有注册的返回默认方言
+func (this *Module) DialectConfig(name string) Dialect {
+	if dialect, ok := this.dialects[name]; ok {
+		return dialect
+	}
+	return &defaultDialect{}
+}
+
+//---------------------------- default ----------------------------
+
+func (this *defaultDialect) Quote(name string) string {
+	return fmt.Sprintf(`%v%v%v`, DELIMS, name, DELIMS)
+}
+func (this *defaultDialect) Placeholder(index int) string {
+	return "?"
+}
+func (this *defaultDialect) Json(field, key string) string {
+	return fmt.Sprintf(`%s->>'%s'`, field, strings.Replace(key, "'", "''", -1))
+}
+func (this *defaultDialect) Element(field string, index int) string {
+	return fmt.Sprintf(`%s[%d]`, field, index)
+}
+func (this *defaultDialect) Any(field, value string) string {
+	return fmt.Sprintf(`%s = ANY(%s)`, value, field)
+}
+func (this *defaultDialect) Contains(field string, values []string) string {
+	return fmt.Sprintf(`%s @> ARRAY[%s]`, field, strings.Join(values, ","))
+}
+func (this *defaultDialect) Contained(field string, values []string) string {
+	return fmt.Sprintf(`%s <@ ARRAY[%s]`, field, strings.Join(values, ","))
+}
+func (this *defaultDialect) Random() string {
+	return RANDBY
+}
+func (this *defaultDialect) Cast(expr, kind string) string {
+	switch kind {
+	case CastInt:
+		//参数保持原来的输出，其它的要加括号
+		if expr == this.Placeholder(0) {
+			return expr + "::int8"
+		}
+		return fmt.Sprintf(`(%s)::int8`, expr)
+	case CastFloat:
+		return fmt.Sprintf(`(%s)::float8`, expr)
+	case CastText:
+		return fmt.Sprintf(`(%s)::text`, expr)
+	}
+	return expr
+}
+func (this *defaultDialect) Pattern(text, mode string, insensitive bool) string {
+	//反斜杠在有的数据库字符串里还要转义，默认用!
+	return likePattern(text, mode, "!")
+}
+func (this *defaultDialect) Like(field, value string, insensitive bool) string {
+	if insensitive {
+		return fmt.Sprintf(`upper(%s) LIKE upper(%s) ESCAPE '!'`, field, value)
+	}
+	return fmt.Sprintf(`%s LIKE %s ESCAPE '!'`, field, value)
+}
+func (this *defaultDialect) Collate(field, collation string) string {
+	return fmt.Sprintf(`%s COLLATE "%s"`, field, strings.Replace(collation, `"`, `""`, -1))
+}
+func (this *defaultDialect) Order(field string, desc bool, nulls string) string {
+	return sqlOrder(field, desc, nulls)
+}
+
+//---------------------------- postgres ----------------------------
+
+func (this *postgresDialect) Quote(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+func (this *postgresDialect) Placeholder(index int) string {
+	return fmt.Sprintf("$%d", index)
+}
+func (this *postgresDialect) Json(field, key string) string {
+	return fmt.Sprintf(`%s->>'%s'`, field, strings.Replace(key, "'", "''", -1))
+}
+func (this *postgresDialect) Element(field string, index int) string {
+	return fmt.Sprintf(`%s[%d]`, field, index)
+}
+func (this *postgresDialect) Any(field, value string) string {
+	return fmt.Sprintf(`%s = ANY(%s)`, value, field)
+}
+func (this *postgresDialect) Contains(field string, values []string) string {
+	return fmt.Sprintf(`%s @> ARRAY[%s]`, field, strings.Join(values, ","))
+}
+func (this *postgresDialect) Contained(field string, values []string) string {
+	return fmt.Sprintf(`%s <@ ARRAY[%s]`, field, strings.Join(values, ","))
+}
+func (this *postgresDialect) Random() string {
+	return "RANDOM()"
+}
+func (this *postgresDialect) Cast(expr, kind string) string {
+	switch kind {
+	case CastInt:
+		return fmt.Sprintf(`(%s)::int8`, expr)
+	case CastFloat:
+		return fmt.Sprintf(`(%s)::float8`, expr)
+	case CastText:
+		return fmt.Sprintf(`(%s)::text`, expr)
+	}
+	return expr
+}
+func (this *postgresDialect) Pattern(text, mode string, insensitive bool) string {
+	return likePattern(text, mode, `\`)
+}
+func (this *postgresDialect) Like(field, value string, insensitive bool) string {
+	if insensitive {
+		return fmt.Sprintf(`%s ILIKE %s ESCAPE '\'`, field, value)
+	}
+	return fmt.Sprintf(`%s LIKE %s ESCAPE '\'`, field, value)
+}
+func (this *postgresDialect) Collate(field, collation string) string {
+	return fmt.Sprintf(`%s COLLATE "%s"`, field, strings.Replace(collation, `"`, `""`, -1))
+}
+func (this *postgresDialect) Order(field string, desc bool, nulls string) string {
+	return sqlOrder(field, desc, nulls)
+}
+
+//---------------------------- mysql ----------------------------
+
+func (this *mysqlDialect) Quote(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+func (this *mysqlDialect) Placeholder(index int) string {
+	return "?"
+}
+func (this *mysqlDialect) Json(field, key string) string {
+	return fmt.Sprintf(`JSON_UNQUOTE(JSON_EXTRACT(%s, '$.%s'))`, field, strings.Replace(key, "'", "''", -1))
+}
+func (this *mysqlDialect) Element(field string, index int) string {
+	return fmt.Sprintf(`JSON_EXTRACT(%s, '$[%d]')`, field, index-1)
+}
+func (this *mysqlDialect) Any(field, value string) string {
+	return fmt.Sprintf(`JSON_CONTAINS(%s, JSON_ARRAY(%s))`, field, value)
+}
+func (this *mysqlDialect) Contains(field string, values []string) string {
+	return fmt.Sprintf(`JSON_CONTAINS(%s, JSON_ARRAY(%s))`, field, strings.Join(values, ","))
+}
+func (this *mysqlDialect) Contained(field string, values []string) string {
+	return fmt.Sprintf(`JSON_CONTAINS(JSON_ARRAY(%s), %s)`, strings.Join(values, ","), field)
+}
+func (this *mysqlDialect) Random() string {
+	return "RAND()"
+}
+func (this *mysqlDialect) Cast(expr, kind string) string {
+	switch kind {
+	case CastInt:
+		return fmt.Sprintf(`CAST(%s AS SIGNED)`, expr)
+	case CastFloat:
+		return fmt.Sprintf(`CAST(%s AS DOUBLE)`, expr)
+	case CastText:
+		return fmt.Sprintf(`CAST(%s AS CHAR)`, expr)
+	}
+	return expr
+}
+func (this *mysqlDialect) Pattern(text, mode string, insensitive bool) string {
+	//反斜杠在mysql的字符串里还要转义，换成!
+	return likePattern(text, mode, "!")
+}
+func (this *mysqlDialect) Like(field, value string, insensitive bool) string {
+	if insensitive {
+		return fmt.Sprintf(`LOWER(%s) LIKE LOWER(%s) ESCAPE '!'`, field, value)
+	}
+	return fmt.Sprintf(`CAST(%s AS BINARY) LIKE %s ESCAPE '!'`, field, value)
+}
+func (this *mysqlDialect) Collate(field, collation string) string {
+	return fmt.Sprintf("%s COLLATE %s", field, this.Quote(collation))
+}
+func (this *mysqlDialect) Order(field string, desc bool, nulls string) string {
+	//mysql 没有 NULLS FIRST，先按是否为空排序
+	order := sqlOrder(field, desc, "")
+	switch nulls {
+	case NullsFirst:
+		return fmt.Sprintf(`%s IS NULL DESC,%s`, field, order)
+	case NullsLast:
+		return fmt.Sprintf(`%s IS NULL ASC,%s`, field, order)
+	}
+	return order
+}
+
+//---------------------------- sqlite ----------------------------
+
+func (this *sqliteDialect) Quote(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+func (this *sqliteDialect) Placeholder(index int) string {
+	return "?"
+}
+func (this *sqliteDialect) Json(field, key string) string {
+	//->> 在postgres里返回的是文本
+	return fmt.Sprintf(`CAST(json_extract(%s, '$.%s') AS TEXT)`, field, strings.Replace(key, "'", "''", -1))
+}
+func (this *sqliteDialect) Element(field string, index int) string {
+	return fmt.Sprintf(`json_extract(%s, '$[%d]')`, field, index-1)
+}
+func (this *sqliteDialect) Any(field, value string) string {
+	return fmt.Sprintf(`%s IN (SELECT value FROM json_each(%s))`, value, field)
+}
+func (this *sqliteDialect) Contains(field string, values []string) string {
+	conds := []string{}
+	for _, value := range values {
+		conds = append(conds, this.Any(field, value))
+	}
+	return fmt.Sprintf("(%s)", strings.Join(conds, " AND "))
+}
+func (this *sqliteDialect) Contained(field string, values []string) string {
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM json_each(%s) WHERE value NOT IN (%s))`, field, strings.Join(values, ","))
+}
+func (this *sqliteDialect) Random() string {
+	return "RANDOM()"
+}
+func (this *sqliteDialect) Cast(expr, kind string) string {
+	switch kind {
+	case CastInt:
+		return fmt.Sprintf(`CAST(%s AS INTEGER)`, expr)
+	case CastFloat:
+		return fmt.Sprintf(`CAST(%s AS REAL)`, expr)
+	case CastText:
+		return fmt.Sprintf(`CAST(%s AS TEXT)`, expr)
+	}
+	return expr
+}
+func (this *sqliteDialect) Pattern(text, mode string, insensitive bool) string {
+	if insensitive {
+		return likePattern(text, mode, `\`)
+	}
+
+	//区分大小写用 GLOB，通配符放到[]里
+	text = strings.NewReplacer("[", "[[]", "*", "[*]", "?", "[?]").Replace(text)
+	switch mode {
+	case LikeLeft:
+		return text + "*"
+	case LikeRight:
+		return "*" + text
+	}
+	return "*" + text + "*"
+}
+func (this *sqliteDialect) Like(field, value string, insensitive bool) string {
+	//sqlite 的 LIKE 默认不区分大小写
+	if insensitive {
+		return fmt.Sprintf(`%s LIKE %s ESCAPE '\'`, field, value)
+	}
+	return fmt.Sprintf(`%s GLOB %s`, field, value)
+}
+func (this *sqliteDialect) Collate(field, collation string) string {
+	return fmt.Sprintf(`%s COLLATE "%s"`, field, strings.Replace(collation, `"`, `""`, -1))
+}
+func (this *sqliteDialect) Order(field string, desc bool, nulls string) string {
+	return sqlOrder(field, desc, nulls)
+}
+
+// sqlOrder 标准的排序
+func sqlOrder(field string, desc bool, nulls string) string {
+	order := fmt.Sprintf(`%s ASC`, field)
+	if desc {
+		order = fmt.Sprintf(`%s DESC`, field)
+	}
+	switch nulls {
+	case NullsFirst:
+		return order + " NULLS FIRST"
+	case NullsLast:
+		return order + " NULLS LAST"
+	}
+	return order
+}
@@ -1,7 +1,9 @@
 package data
 
 import (
+	"context"
 	"database/sql"
+	"time"
 
 	. "github.com/chefsgo/base"
 )
@@ -23,6 +25,8 @@ type (
 
 	Health struct {
 		Workload int64
+		//只读副本的复制延迟
+		Lag time.Duration
 	}
 	// DataTrigger struct {
 	// 	Name  string
@@ -33,6 +37,9 @@ type (
 		Close() error
 		Erred() error
 
+		//设置上下文，用于取消和超时，返回自身
+		WithContext(ctx context.Context) DataBase
+
 		Table(name string) DataTable
 		View(name string) DataView
 		Model(name string) DataModel
@@ -41,15 +48,23 @@ type (
 		Break(key string)
 
 		//开启手动提交事务模式
+		//事务中再次Begin为保存点，Cancel只回滚到保存点，最外层的Submit才提交
 		Begin() (*sql.Tx, error)
 		Submit() error
 		Cancel() error
+		//事务的层数，0为不在事务中
+		Depth() int
+
+		//在事务中执行，出错或panic回滚，死锁等可以重试的错误自动重试
+		Transaction(call func(DataBase) error, opts ...TxOption) error
 	}
 
 	DataTable interface {
 		Create(Map) Map
 		Change(Map, Map) Map
+		//开启了软删除的表，直接写sql的查询要加上 WithDeleted
 		Remove(...Any) Map
+		Recover(...Any) Map
 		Update(sets Map, args ...Any) int64
 		Delete(args ...Any) int64
 
@@ -59,6 +74,9 @@ type (
 		Query(args ...Any) []Map
 		Limit(offset, limit Any, args ...Any) (int64, []Map)
 		Group(field string, args ...Any) []Map
+
+		//返回错误的版本
+		Checked() CheckedTable
 	}
 
 	//数据视图接口
@@ -68,11 +86,49 @@ type (
 		Query(args ...Any) []Map
 		Limit(offset, limit Any, args ...Any) (int64, []Map)
 		Group(field string, args ...Any) []Map
+
+		Checked() CheckedView
 	}
 
 	//数据模型接口
 	DataModel interface {
 		First(args ...Any) Map
 		Query(args ...Any) []Map
+
+		Checked() CheckedModel
+	}
+
+	// CheckedTable 直接返回错误的数据表接口，和 DataTable 一一对应
+	// 不依赖 Erred，同一个 DataBase 并发使用也不会拿错错误
+	// 没有找到数据的 Entity, First, Change, Remove, Recover 返回 ErrNotFound
+	CheckedTable interface {
+		Create(Map) (Map, error)
+		Change(Map, Map) (Map, error)
+		Remove(...Any) (Map, error)
+		Recover(...Any) (Map, error)
+		Update(sets Map, args ...Any) (int64, error)
+		Delete(args ...Any) (int64, error)
+
+		Entity(Any) (Map, error)
+		Count(args ...Any) (float64, error)
+		First(args ...Any) (Map, error)
+		Query(args ...Any) ([]Map, error)
+		Limit(offset, limit Any, args ...Any) (int64, []Map, error)
+		Group(field string, args ...Any) ([]Map, error)
+	}
+
+	// CheckedView 直接返回错误的数据视图接口
+	CheckedView interface {
+		Count(args ...Any) (float64, error)
+		First(args ...Any) (Map, error)
+		Query(args ...Any) ([]Map, error)
+		Limit(offset, limit Any, args ...Any) (int64, []Map, error)
+		Group(field string, args ...Any) ([]Map, error)
+	}
+
+	// CheckedModel 直接返回错误的数据模型接口
+	CheckedModel interface {
+		First(args ...Any) (Map, error)
+		Query(args ...Any) ([]Map, error)
 	}
 )
@@ -0,0 +1,267 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+
+	. "github.com/chefsgo/base"
+)
+
+// 带类型的错误
+// Checked 接口返回的错误都可以用 errors.Is 判断类型，比如 errors.Is(err, ErrNotFound)
+// 驱动的原始错误会保留下来，errors.As 还是能拿到
+// 驱动用 WrapError 给原生错误加上类型，postgres 和 mysql 可以直接用 SQLStateError 和 MysqlError
+// DataTable 等原来的接口由 Checked 包装，错误记录下来由 Erred 返回，没有找到数据不算错误
+
+type (
+	// dataError 给原始错误加上类型
+	dataError struct {
+		kind error
+		err  error
+	}
+
+	// checkedTable 用 CheckedTable 实现 DataTable
+	// 驱动和模块层只需要实现返回错误的版本
+	checkedTable struct {
+		table     CheckedTable
+		lastError *error
+	}
+	checkedView struct {
+		view      CheckedView
+		lastError *error
+	}
+	checkedModel struct {
+		model     CheckedModel
+		lastError *error
+	}
+)
+
+func (this *dataError) Error() string {
+	return this.err.Error()
+}
+func (this *dataError) Unwrap() error {
+	return this.err
+}
+func (this *dataError) Is(target error) bool {
+	return errors.Is(this.kind, target)
+}
+
+// erroring 给错误加上类型，已经是这个类型的不处理
+func erroring(kind, err error) error {
+	if err == nil || errors.Is(err, kind) {
+		return err
+	}
+	return &dataError{kind, err}
+}
+
+// WrapError 给驱动的原生错误加上类型，kind 为 ErrDuplicate 等
+func WrapError(kind, err error) error {
+	return erroring(kind, err)
+}
+
+// SQLStateError 按 SQLSTATE 错误码归类，postgres 等标准的数据库通用
+// 不认识的错误码只做超时和连接断开的归类
+func SQLStateError(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case code == "23505":
+		return erroring(ErrDuplicate, err)
+	case strings.HasPrefix(code, "23"):
+		return erroring(ErrConstraint, err)
+	case code == "40P01":
+		return erroring(ErrDeadlock, err)
+	case code == "40001":
+		return erroring(ErrSerialization, err)
+	case code == "57014":
+		return erroring(ErrTimeout, err)
+	case strings.HasPrefix(code, "42"), strings.HasPrefix(code, "22"):
+		return erroring(ErrInvalidQuery, err)
+	case strings.HasPrefix(code, "08"), code == "57P01":
+		return erroring(ErrConnectionLost, err)
+	}
+	return classify(err)
+}
+
+// MysqlError 按 mysql 的错误号归类
+func MysqlError(number int, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch number {
+	case 1062, 1586:
+		return erroring(ErrDuplicate, err)
+	case 1048, 1216, 1217, 1451, 1452, 3819:
+		return erroring(ErrConstraint, err)
+	case 1213:
+		return erroring(ErrDeadlock, err)
+	case 1205, 3024:
+		return erroring(ErrTimeout, err)
+	case 1054, 1064, 1146, 1149:
+		return erroring(ErrInvalidQuery, err)
+	case 2006, 2013:
+		return erroring(ErrConnectionLost, err)
+	}
+	return classify(err)
+}
+
+// classify 归类标准库的错误，超时和连接断开
+func classify(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded):
+		return erroring(ErrTimeout, err)
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone):
+		return erroring(ErrConnectionLost, err)
+	}
+	return err
+}
+
+// recording 记录错误，没有找到数据的不记录
+func recording(lastError *error, err error) {
+	if err != nil && errors.Is(err, ErrNotFound) == false {
+		*lastError = err
+	}
+}
+
+//---------------------------- table ----------------------------
+
+func (this *checkedTable) Checked() CheckedTable {
+	return this.table
+}
+
+func (this *checkedTable) Create(data Map) Map {
+	item, err := this.table.Create(data)
+	recording(this.lastError, err)
+	return item
+}
+func (this *checkedTable) Change(item Map, data Map) Map {
+	after, err := this.table.Change(item, data)
+	recording(this.lastError, err)
+	return after
+}
+func (this *checkedTable) Remove(args ...Any) Map {
+	item, err := this.table.Remove(args...)
+	recording(this.lastError, err)
+	return item
+}
+func (this *checkedTable) Recover(args ...Any) Map {
+	item, err := this.table.Recover(args...)
+	recording(this.lastError, err)
+	return item
+}
+func (this *checkedTable) Update(sets Map, args ...Any) int64 {
+	count, err := this.table.Update(sets, args...)
+	recording(this.lastError, err)
+	return count
+}
+func (this *checkedTable) Delete(args ...Any) int64 {
+	count, err := this.table.Delete(args...)
+	recording(this.lastError, err)
+	return count
+}
+func (this *checkedTable) Entity(id Any) Map {
+	item, err := this.table.Entity(id)
+	recording(this.lastError, err)
+	return item
+}
+func (this *checkedTable) Count(args ...Any) float64 {
+	count, err := this.table.Count(args...)
+	recording(this.lastError, err)
+	return count
+}
+func (this *checkedTable) First(args ...Any) Map {
+	item, err := this.table.First(args...)
+	recording(this.lastError, err)
+	return item
+}
+func (this *checkedTable) Query(args ...Any) []Map {
+	items, err := this.table.Query(args...)
+	recording(this.lastError, err)
+	if items == nil {
+		return []Map{}
+	}
+	return items
+}
+func (this *checkedTable) Limit(offset, limit Any, args ...Any) (int64, []Map) {
+	total, items, err := this.table.Limit(offset, limit, args...)
+	recording(this.lastError, err)
+	if items == nil {
+		return total, []Map{}
+	}
+	return total, items
+}
+func (this *checkedTable) Group(field string, args ...Any) []Map {
+	items, err := this.table.Group(field, args...)
+	recording(this.lastError, err)
+	if items == nil {
+		return []Map{}
+	}
+	return items
+}
+
+//---------------------------- view & model ----------------------------
+
+func (this *checkedView) Checked() CheckedView {
+	return this.view
+}
+
+func (this *checkedView) Count(args ...Any) float64 {
+	count, err := this.view.Count(args...)
+	recording(this.lastError, err)
+	return count
+}
+func (this *checkedView) First(args ...Any) Map {
+	item, err := this.view.First(args...)
+	recording(this.lastError, err)
+	return item
+}
+func (this *checkedView) Query(args ...Any) []Map {
+	items, err := this.view.Query(args...)
+	recording(this.lastError, err)
+	if items == nil {
+		return []Map{}
+	}
+	return items
+}
+func (this *checkedView) Limit(offset, limit Any, args ...Any) (int64, []Map) {
+	total, items, err := this.view.Limit(offset, limit, args...)
+	recording(this.lastError, err)
+	if items == nil {
+		return total, []Map{}
+	}
+	return total, items
+}
+func (this *checkedView) Group(field string, args ...Any) []Map {
+	items, err := this.view.Group(field, args...)
+	recording(this.lastError, err)
+	if items == nil {
+		return []Map{}
+	}
+	return items
+}
+
+func (this *checkedModel) Checked() CheckedModel {
+	return this.model
+}
+
+func (this *checkedModel) First(args ...Any) Map {
+	item, err := this.model.First(args...)
+	recording(this.lastError, err)
+	return item
+}
+func (this *checkedModel) Query(args ...Any) []Map {
+	items, err := this.model.Query(args...)
+	recording(this.lastError, err)
+	if items == nil {
+		return []Map{}
+	}
+	return items
+}
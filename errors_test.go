@@ -0,0 +1,126 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/chefsgo/base"
+)
+
+func TestCheckedTable(t *testing.T) {
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_checked", Map{"name": "a"})
+	checked := db.Table("test_checked").Checked()
+
+	if _, err := checked.First(Map{"name": "none"}); errors.Is(err, ErrNotFound) == false {
+		t.Errorf("first: got %v, want ErrNotFound", err)
+	}
+	if _, err := checked.Create(Map{"id": 1, "name": "b"}); errors.Is(err, ErrDuplicate) == false {
+		t.Errorf("create: got %v, want ErrDuplicate", err)
+	}
+	if _, err := checked.Query(Map{"name": Map{OR: []Any{}}}); errors.Is(err, ErrInvalidQuery) == false {
+		t.Errorf("query: got %v, want ErrInvalidQuery", err)
+	}
+	if err := db.Erred(); err != nil {
+		t.Errorf("checked errors should not be recorded, got %v", err)
+	}
+
+	//原来的接口，错误通过 Erred 拿，没有找到的不算错误
+	table := db.Table("test_checked")
+	if item := table.First(Map{"name": "none"}); item != nil {
+		t.Errorf("first: got %v, want nil", item)
+	}
+	if err := db.Erred(); err != nil {
+		t.Errorf("not found should not be recorded, got %v", err)
+	}
+
+	if item := table.Create(Map{"id": 1, "name": "b"}); item != nil {
+		t.Errorf("create: got %v, want nil", item)
+	}
+	if err := db.Erred(); errors.Is(err, ErrDuplicate) == false {
+		t.Errorf("erred: got %v, want ErrDuplicate", err)
+	}
+	if err := db.Erred(); err != nil {
+		t.Errorf("erred should be cleared, got %v", err)
+	}
+
+	if items := table.Query(Map{"name": Map{OR: []Any{}}}); items == nil || len(items) != 0 {
+		t.Errorf("query: got %#v, want empty", items)
+	}
+	if err := db.Erred(); errors.Is(err, ErrInvalidQuery) == false {
+		t.Errorf("erred: got %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	for _, kind := range []error{ErrDuplicate, ErrDeadlock, ErrSerialization} {
+		if errors.Is(kind, ErrConflict) == false {
+			t.Errorf("%v should be ErrConflict", kind)
+		}
+	}
+	for _, kind := range []error{ErrNotFound, ErrConstraint, ErrTimeout, ErrInvalidQuery} {
+		if errors.Is(kind, ErrConflict) {
+			t.Errorf("%v should not be ErrConflict", kind)
+		}
+	}
+	if errors.Is(ErrDuplicate, ErrDeadlock) {
+		t.Errorf("ErrDuplicate should not be ErrDeadlock")
+	}
+}
+
+// errorsNative 测试用的驱动原生错误
+type errorsNative struct {
+	code string
+}
+
+func (this *errorsNative) Error() string {
+	return "native " + this.code
+}
+
+func TestErrorMapping(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"sqlstate unique", SQLStateError("23505", &errorsNative{"23505"}), ErrDuplicate},
+		{"sqlstate not null", SQLStateError("23502", &errorsNative{"23502"}), ErrConstraint},
+		{"sqlstate deadlock", SQLStateError("40P01", &errorsNative{"40P01"}), ErrDeadlock},
+		{"sqlstate serialization", SQLStateError("40001", &errorsNative{"40001"}), ErrSerialization},
+		{"sqlstate canceled", SQLStateError("57014", &errorsNative{"57014"}), ErrTimeout},
+		{"sqlstate syntax", SQLStateError("42601", &errorsNative{"42601"}), ErrInvalidQuery},
+		{"sqlstate connection", SQLStateError("08006", &errorsNative{"08006"}), ErrConnectionLost},
+		{"mysql duplicate", MysqlError(1062, &errorsNative{"1062"}), ErrDuplicate},
+		{"mysql foreign", MysqlError(1452, &errorsNative{"1452"}), ErrConstraint},
+		{"mysql deadlock", MysqlError(1213, &errorsNative{"1213"}), ErrDeadlock},
+		{"mysql lock wait", MysqlError(1205, &errorsNative{"1205"}), ErrTimeout},
+		{"mysql syntax", MysqlError(1064, &errorsNative{"1064"}), ErrInvalidQuery},
+		{"mysql gone", MysqlError(2006, &errorsNative{"2006"}), ErrConnectionLost},
+		{"deadline", classify(fmt.Errorf("query: %w", context.DeadlineExceeded)), ErrTimeout},
+		{"bad conn", classify(driver.ErrBadConn), ErrConnectionLost},
+		{"wrap", WrapError(ErrDuplicate, &errorsNative{"x"}), ErrConflict},
+	}
+
+	for _, test := range tests {
+		if errors.Is(test.err, test.want) == false {
+			t.Errorf("%s: got %v, want %v", test.name, test.err, test.want)
+		}
+		var native *errorsNative
+		if _, ok := errors.Unwrap(test.err).(*errorsNative); ok && errors.As(test.err, &native) == false {
+			t.Errorf("%s: native error lost", test.name)
+		}
+	}
+
+	if err := SQLStateError("XX000", &errorsNative{"XX000"}); errors.Is(err, ErrConflict) || errors.Is(err, ErrConstraint) {
+		t.Errorf("unknown code: got %v", err)
+	}
+	if SQLStateError("23505", nil) != nil || MysqlError(1062, nil) != nil || classify(nil) != nil {
+		t.Errorf("nil errors should stay nil")
+	}
+	if err := WrapError(ErrDuplicate, ErrDuplicate); err != ErrDuplicate {
+		t.Errorf("wrap twice: got %#v", err)
+	}
+}
@@ -1,6 +1,9 @@
 package data
 
 import (
+	"context"
+	"time"
+
 	. "github.com/chefsgo/base"
 )
 
@@ -10,6 +13,11 @@ func Base(names ...string) DataBase {
 	return module.Base(names...)
 }
 
+// GetBase 和 Base 一样，找不到连接返回错误，不会panic
+func GetBase(names ...string) (DataBase, error) {
+	return module.GetBase(names...)
+}
+
 func GetTable(name string) *Table {
 	return module.TableConfig(name)
 }
@@ -33,11 +41,97 @@ func Options(name string, field string) Map {
 	return module.Options(name, field)
 }
 
+// Validate 按表定义校验数据，partial 为 true 时只校验传入的字段
+func Validate(name string, value Map, partials ...bool) (Map, error) {
+	partial := false
+	if len(partials) > 0 {
+		partial = partials[0]
+	}
+	return module.Validate(name, value, partial)
+}
+
 func ParseSQL(args ...Any) (string, []Any, string, error) {
 	return module.Parse(args...)
 }
 
-//接收回来触发器
+// Timeout 连接配置的默认查询超时，没有配置返回0
+func Timeout(config Config) time.Duration {
+	return module.timeout(config)
+}
+
+// WithTimeout 给上下文加上连接配置的查询超时
+// 其它模块的驱动在每次执行查询前使用，执行完调用返回的 CancelFunc
+func WithTimeout(ctx context.Context, config Config) (context.Context, context.CancelFunc) {
+	return module.timeouting(ctx, config)
+}
+
+// ParseTree 解析查询为语法树，非SQL的驱动遍历语法树自行处理
+func ParseTree(args ...Any) (*Query, error) {
+	return module.ParseTree(args...)
+}
+
+// ParsePage 解析查询为带分页的语法树
+func ParsePage(offset, limit Any, args ...Any) (*Query, error) {
+	return module.ParsePage(offset, limit, args...)
+}
+
+// RenderSQL 把语法树按方言生成SQL
+func RenderSQL(dialect Dialect, query *Query) (string, []Any, string, error) {
+	return module.Render(dialect, query)
+}
+
+// ParseSQLWith 按方言生成SQL，驱动注册了方言的用这个
+func ParseSQLWith(dialect Dialect, args ...Any) (string, []Any, string, error) {
+	return module.ParseWith(dialect, args...)
+}
+
+// GetDialect 获取方言，没有注册的返回默认方言
+func GetDialect(name string) Dialect {
+	return module.DialectConfig(name)
+}
+
+// Fingerprint 查询的指纹，同样的查询和参数得到同样的指纹
+func Fingerprint(args ...Any) (string, error) {
+	return module.Fingerprint(args...)
+}
+
+// Strict 按严格模式检查查询，不管有没有开启严格模式
+// 字段或操作符不允许的返回 ErrInvalidQuery
+func Strict(name string, args ...Any) error {
+	return module.Strict(name, args...)
+}
+
+// DiffSchema 连接待执行的结构变更，不执行
+func DiffSchema(name string) ([]SchemaChange, error) {
+	return module.DiffSchema(name)
+}
+
+// MigrateSchema 执行连接的结构变更
+func MigrateSchema(name string) ([]SchemaChange, error) {
+	return module.MigrateSchema(name)
+}
+
+// Migrate 执行连接上所有未执行的版本迁移
+func Migrate(name string) (int, error) {
+	return module.Migrate(name)
+}
+
+// Rollback 回滚连接上最近执行的 steps 个版本迁移
+func Rollback(name string, steps int) (int, error) {
+	return module.Rollback(name, steps)
+}
+
+// GetMigrationStatus 连接上所有版本迁移的状态
+func GetMigrationStatus(name string) ([]MigrationStatus, error) {
+	return module.MigrationStatus(name)
+}
+
+// Relay 重新投递发件箱中的事件，返回成功投递的数量
+func Relay(name string, send func(Event) error) (int64, error) {
+	return module.Relay(name, send)
+}
+
+//接收回来触发器，分发给注册的监听
 func Trigger(name string, values ...Map) {
-	//待处理，接入chef，或是提供其它方向的 代理
+	module.triggering(name, values...)
 }
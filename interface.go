@@ -1,6 +1,8 @@
 package data
 
 import (
+	"sort"
+
 	. "github.com/chefsgo/base"
 	"github.com/chefsgo/chef"
 )
@@ -19,6 +21,16 @@ func (this *Module) Register(key string, value Any, override bool) {
 		module.View(key, val, override)
 	case Model:
 		module.Model(key, val, override)
+	case Dialect:
+		module.Dialect(key, val, override)
+	case Watcher:
+		module.Watcher(key, val, override)
+	case SerialProvider:
+		module.SerialProvider(key, val, override)
+	case Migration:
+		module.Migration(key, val, override)
+	case Operator:
+		module.Operator(key, val, override)
 	}
 }
 
@@ -42,10 +54,31 @@ func (this *Module) configure(name string, config Map) {
 	if serial, ok := config["serial"].(string); ok {
 		cfg.Serial = serial
 	}
+	if provider, ok := config["serial_provider"].(string); ok {
+		cfg.SerialProvider = provider
+	}
 	if setting, ok := config["setting"].(Map); ok {
 		cfg.Setting = setting
 	}
 
+	//只读副本
+	if replicas, ok := config["replicas"].([]string); ok {
+		cfg.Replicas = replicas
+	} else if replicas, ok := config["replicas"].([]Any); ok {
+		cfg.Replicas = []string{}
+		for _, replica := range replicas {
+			if url, ok := replica.(string); ok {
+				cfg.Replicas = append(cfg.Replicas, url)
+			}
+		}
+	}
+	if routing, ok := config["routing"].(string); ok {
+		cfg.Routing = routing
+	}
+	if vv, ok := config["default"].(bool); ok {
+		cfg.Default = vv
+	}
+
 	//保存配置
 	this.configs[name] = cfg
 }
@@ -106,8 +139,32 @@ func (this *Module) Connect() {
 		//保存连接
 		this.instances[name] = Instance{
 			name, config, connect,
+			this.replicating(name, config, driver),
 		}
 
+		//序列，雪花算法要配置节点
+		if err := this.serialChecking(config); err != nil {
+			panic("Failed to check data serial: " + err.Error())
+		}
+
+		//发件箱
+		if err := this.outboxing(name, config); err != nil {
+			panic("Failed to create data outbox: " + err.Error())
+		}
+		//迁移记录
+		if err := this.migrationing(name, config); err != nil {
+			panic("Failed to check data migration: " + err.Error())
+		}
+	}
+
+	//所有的连接都建好之后再迁移，按名称排序
+	names := []string{}
+	for name := range this.instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		this.migrating(name, this.instances[name].config)
 	}
 
 	this.connected = true
@@ -122,6 +179,7 @@ func (this *Module) Launch() {
 func (this *Module) Terminate() {
 	for _, ins := range this.instances {
 		ins.connect.Close()
+		ins.router.close()
 	}
 
 	this.launched = false
@@ -0,0 +1,1006 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/chefsgo/base"
+)
+
+// 内存驱动，所有数据都保存在进程内，重启即丢失
+// 主要用于单元测试和本地开发，不依赖任何外部数据库
+func init() {
+	module.Driver("memory", &memoryDriver{}, false)
+}
+
+var (
+	errMemoryRawQuery = errors.New("Memory driver does not support raw sql query.")
+)
+
+type (
+	memoryDriver  struct{}
+	memoryConnect struct {
+		mutex  sync.RWMutex
+		name   string
+		config Config
+
+		tables  map[string]*memoryStore
+		serials map[string]int64
+	}
+	memoryStore struct {
+		serial int64
+		rows   []Map
+	}
+	memoryBase struct {
+		connect   *memoryConnect
+		ctx       context.Context
+		lastError error
+
+		//事务快照，每层Begin一份，只保存这一层第一次写入前的表
+		//Cancel时只还原这些表，其它的表不受影响，为nil表示写入前表还不存在
+		snapshots []map[string]*memoryStore
+	}
+	memoryTable struct {
+		base    *memoryBase
+		name    string
+		source  string
+		key     string
+		fields  Vars
+		uniques []Index
+	}
+	memoryView struct {
+		memoryTable
+	}
+	memoryModel struct {
+		memoryTable
+	}
+)
+
+// Connect 连接
+func (driver *memoryDriver) Connect(name string, config Config) (Connect, error) {
+	return &memoryConnect{
+		name: name, config: config,
+		tables: map[string]*memoryStore{}, serials: map[string]int64{},
+	}, nil
+}
+
+// Open 打开连接
+func (this *memoryConnect) Open() error {
+	return nil
+}
+
+// Health 运行状态
+// 返回总行数做为负载
+func (this *memoryConnect) Health() (Health, error) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	workload := int64(0)
+	for _, store := range this.tables {
+		workload += int64(len(store.rows))
+	}
+	return Health{Workload: workload}, nil
+}
+
+// Close 关闭连接
+func (this *memoryConnect) Close() error {
+	return nil
+}
+
+func (this *memoryConnect) Base() DataBase {
+	return &memoryBase{connect: this}
+}
+
+// store 拿表数据，不存在就创建，调用前需要加锁
+func (this *memoryConnect) store(name string) *memoryStore {
+	if store, ok := this.tables[name]; ok {
+		return store
+	}
+	store := &memoryStore{}
+	this.tables[name] = store
+	return store
+}
+
+func (this *memoryBase) Close() error {
+	//未提交的事务自动回滚，包括所有的保存点
+	this.connect.mutex.Lock()
+	defer this.connect.mutex.Unlock()
+
+	for i := len(this.snapshots) - 1; i >= 0; i-- {
+		this.connect.restore(this.snapshots[i])
+	}
+	this.snapshots = nil
+	return nil
+}
+func (this *memoryBase) Erred() error {
+	err := this.lastError
+	this.lastError = nil
+	return err
+}
+
+// WithContext 设置上下文，返回自身
+// 内存操作不会阻塞，只在执行前检查是否已经取消或超时
+func (this *memoryBase) WithContext(ctx context.Context) DataBase {
+	this.ctx = ctx
+	return this
+}
+
+// canceled 上下文已经取消或超时的，返回错误
+// 内存的操作不会等待IO，配置的 timeout 对内存驱动没有意义，只检查上下文
+func (this *memoryBase) canceled() error {
+	if this.ctx == nil {
+		return nil
+	}
+	return classify(this.ctx.Err())
+}
+
+func (this *memoryBase) Table(name string) DataTable {
+	module.mutex.RLock()
+	defer module.mutex.RUnlock()
+
+	table := &memoryTable{base: this, name: name, source: name, key: "id"}
+	if config, ok := module.tables[name]; ok {
+		if config.Table != "" {
+			table.source = config.Table
+		}
+		if config.Key != "" {
+			table.key = config.Key
+		}
+		table.fields = config.Fields
+		table.uniques = config.Uniques
+	}
+	return &checkedTable{table, &this.lastError}
+}
+func (this *memoryBase) View(name string) DataView {
+	module.mutex.RLock()
+	defer module.mutex.RUnlock()
+
+	view := &memoryView{memoryTable{base: this, name: name, source: name, key: "id"}}
+	if config, ok := module.views[name]; ok {
+		if config.View != "" {
+			view.source = config.View
+		}
+		if config.Key != "" {
+			view.key = config.Key
+		}
+		view.fields = config.Fields
+	}
+	return &checkedView{view, &this.lastError}
+}
+func (this *memoryBase) Model(name string) DataModel {
+	module.mutex.RLock()
+	defer module.mutex.RUnlock()
+
+	model := &memoryModel{memoryTable{base: this, name: name, source: name, key: "id"}}
+	if config, ok := module.models[name]; ok {
+		if config.Model != "" {
+			model.source = config.Model
+		}
+		if config.Key != "" {
+			model.key = config.Key
+		}
+		model.fields = config.Fields
+	}
+	return &checkedModel{model, &this.lastError}
+}
+
+// Serial 序列
+func (this *memoryBase) Serial(key string, start, step int64) int64 {
+	this.connect.mutex.Lock()
+	defer this.connect.mutex.Unlock()
+
+	if step == 0 {
+		step = 1
+	}
+
+	value, ok := this.connect.serials[key]
+	if ok {
+		value += step
+	} else {
+		value = start
+	}
+	this.connect.serials[key] = value
+
+	return value
+}
+
+// Break 删除序列
+func (this *memoryBase) Break(key string) {
+	this.connect.mutex.Lock()
+	defer this.connect.mutex.Unlock()
+
+	delete(this.connect.serials, key)
+}
+
+// Sequence 内存的序列和序列表是一样的
+func (this *memoryBase) Sequence(key string, start, step int64) (int64, error) {
+	return this.Serial(key, start, step), nil
+}
+
+// DropSequence 删除序列
+func (this *memoryBase) DropSequence(key string) error {
+	this.Break(key)
+	return nil
+}
+
+// Begin 开启事务
+// 内存驱动没有真实的sql.Tx，写入前保存表的快照，取消时还原
+// 事务中再次Begin相当于保存点，再开一层快照
+// 序列和数据库的一样，不会回滚
+func (this *memoryBase) Begin() (*sql.Tx, error) {
+	this.snapshots = append(this.snapshots, map[string]*memoryStore{})
+	return nil, nil
+}
+
+// Submit 提交事务，内层的只是释放保存点
+// 快照合并到上一层，上一层已经有的表以上一层的为准
+func (this *memoryBase) Submit() error {
+	count := len(this.snapshots)
+	if count == 0 {
+		return nil
+	}
+	if count > 1 {
+		parent := this.snapshots[count-2]
+		for name, store := range this.snapshots[count-1] {
+			if _, ok := parent[name]; ok == false {
+				parent[name] = store
+			}
+		}
+	}
+	this.snapshots = this.snapshots[:count-1]
+	return nil
+}
+
+// Cancel 取消事务，内层的只回滚到保存点
+func (this *memoryBase) Cancel() error {
+	this.connect.mutex.Lock()
+	defer this.connect.mutex.Unlock()
+
+	if count := len(this.snapshots); count > 0 {
+		this.connect.restore(this.snapshots[count-1])
+		this.snapshots = this.snapshots[:count-1]
+	}
+	return nil
+}
+
+// Depth 事务的层数，0为不在事务中
+func (this *memoryBase) Depth() int {
+	return len(this.snapshots)
+}
+
+// Transaction 在事务中执行
+// 内存驱动的事务是串行的快照，隔离级别和只读选项不起作用
+func (this *memoryBase) Transaction(call func(DataBase) error, opts ...TxOption) error {
+	begin := func(TxOption) error {
+		_, err := this.Begin()
+		return err
+	}
+	return module.transaction(this, begin, call, opts...)
+}
+
+// writing 拿要写入的表数据，事务中这一层第一次写入的先保存快照，调用前需要加锁
+func (this *memoryBase) writing(name string) *memoryStore {
+	if count := len(this.snapshots); count > 0 {
+		snapshot := this.snapshots[count-1]
+		if _, ok := snapshot[name]; ok == false {
+			snapshot[name] = this.connect.snapshot(name)
+		}
+	}
+	return this.connect.store(name)
+}
+
+// restore 还原快照里的表，调用前需要加锁
+func (this *memoryConnect) restore(snapshot map[string]*memoryStore) {
+	for name, store := range snapshot {
+		if store == nil {
+			delete(this.tables, name)
+		} else {
+			this.tables[name] = store
+		}
+	}
+}
+
+// snapshot 复制一份表当前的数据，表不存在返回nil，调用前需要加锁
+func (this *memoryConnect) snapshot(name string) *memoryStore {
+	store, ok := this.tables[name]
+	if ok == false {
+		return nil
+	}
+	rows := make([]Map, 0, len(store.rows))
+	for _, row := range store.rows {
+		rows = append(rows, memoryClone(row))
+	}
+	return &memoryStore{store.serial, rows}
+}
+
+//---------------------------- table ----------------------------
+
+func (this *memoryTable) Create(data Map) (Map, error) {
+	if err := this.base.canceled(); err != nil {
+		return nil, err
+	}
+
+	this.base.connect.mutex.Lock()
+	defer this.base.connect.mutex.Unlock()
+
+	store := this.base.writing(this.source)
+
+	item := memoryClone(data)
+	if id, ok := item[this.key]; ok == false || id == nil {
+		store.serial++
+		item[this.key] = store.serial
+	} else if vv, ok := memoryNumber(id); ok && int64(vv) > store.serial {
+		store.serial = int64(vv)
+	}
+
+	for _, row := range store.rows {
+		if memoryEqual(row[this.key], item[this.key]) {
+			return nil, erroring(ErrDuplicate, fmt.Errorf("Duplicate key %v in %s.", item[this.key], this.name))
+		}
+	}
+	if err := this.unique(store, item); err != nil {
+		return nil, err
+	}
+
+	store.rows = append(store.rows, item)
+	return memoryClone(item), nil
+}
+
+func (this *memoryTable) Change(item Map, data Map) (Map, error) {
+	if err := this.base.canceled(); err != nil {
+		return nil, err
+	}
+	if item == nil || item[this.key] == nil {
+		return nil, errors.New("Invalid item to change.")
+	}
+
+	this.base.connect.mutex.Lock()
+	defer this.base.connect.mutex.Unlock()
+
+	store := this.base.writing(this.source)
+	for _, row := range store.rows {
+		if memoryEqual(row[this.key], item[this.key]) {
+			changed := memoryClone(row)
+			memoryApply(changed, data)
+			if err := this.unique(store, changed); err != nil {
+				return nil, err
+			}
+			memoryApply(row, data)
+			return memoryClone(row), nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// unique 检查唯一约束，和自己主键相同的行不算，字段有nil的不检查
+func (this *memoryTable) unique(store *memoryStore, item Map) error {
+	for _, index := range this.uniques {
+		for _, row := range store.rows {
+			if memoryEqual(row[this.key], item[this.key]) {
+				continue
+			}
+
+			same := len(index.Fields) > 0
+			for _, field := range index.Fields {
+				if item[field] == nil || memoryEqual(row[field], item[field]) == false {
+					same = false
+					break
+				}
+			}
+			if same {
+				return erroring(ErrDuplicate, fmt.Errorf("Duplicate %s in %s.", strings.Join(index.Fields, ","), this.name))
+			}
+		}
+	}
+	return nil
+}
+
+func (this *memoryTable) Remove(args ...Any) (Map, error) {
+	if err := this.base.canceled(); err != nil {
+		return nil, err
+	}
+
+	this.base.connect.mutex.Lock()
+	defer this.base.connect.mutex.Unlock()
+
+	store := this.base.writing(this.source)
+	rows, err := this.filter(store.rows, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+
+	item := rows[0]
+	for i, row := range store.rows {
+		if memoryEqual(row[this.key], item[this.key]) {
+			store.rows = append(store.rows[:i], store.rows[i+1:]...)
+			break
+		}
+	}
+
+	return memoryClone(item), nil
+}
+
+// Recover 恢复软删除的数据，表没有开启软删除返回 ErrNotFound
+func (this *memoryTable) Recover(args ...Any) (Map, error) {
+	_, item, err := module.softRecovering(this.name, this, args...)
+	return item, err
+}
+
+func (this *memoryTable) Update(sets Map, args ...Any) (int64, error) {
+	if err := this.base.canceled(); err != nil {
+		return 0, err
+	}
+
+	this.base.connect.mutex.Lock()
+	defer this.base.connect.mutex.Unlock()
+
+	store := this.base.writing(this.source)
+	rows, err := this.filter(store.rows, args...)
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		memoryApply(row, sets)
+	}
+	return int64(len(rows)), nil
+}
+
+func (this *memoryTable) Delete(args ...Any) (int64, error) {
+	if err := this.base.canceled(); err != nil {
+		return 0, err
+	}
+
+	this.base.connect.mutex.Lock()
+	defer this.base.connect.mutex.Unlock()
+
+	store := this.base.writing(this.source)
+	rows, err := this.filter(store.rows, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := map[int]bool{}
+	for _, row := range rows {
+		for i, vv := range store.rows {
+			if memoryEqual(vv[this.key], row[this.key]) {
+				removed[i] = true
+			}
+		}
+	}
+
+	remains := []Map{}
+	for i, row := range store.rows {
+		if removed[i] == false {
+			remains = append(remains, row)
+		}
+	}
+	store.rows = remains
+
+	return int64(len(removed)), nil
+}
+
+func (this *memoryTable) Entity(id Any) (Map, error) {
+	return this.First(Map{this.key: id})
+}
+
+func (this *memoryTable) Count(args ...Any) (float64, error) {
+	rows, err := this.Query(args...)
+	return float64(len(rows)), err
+}
+
+func (this *memoryTable) First(args ...Any) (Map, error) {
+	rows, err := this.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return rows[0], nil
+}
+
+func (this *memoryTable) Query(args ...Any) ([]Map, error) {
+	if err := this.base.canceled(); err != nil {
+		return []Map{}, err
+	}
+
+	this.base.connect.mutex.RLock()
+	defer this.base.connect.mutex.RUnlock()
+
+	store, ok := this.base.connect.tables[this.source]
+	if ok == false {
+		return []Map{}, nil
+	}
+
+	rows, err := this.filter(store.rows, args...)
+	if err != nil {
+		return []Map{}, err
+	}
+
+	items := make([]Map, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, memoryClone(row))
+	}
+	return items, nil
+}
+
+func (this *memoryTable) Limit(offset, limit Any, args ...Any) (int64, []Map, error) {
+	query, err := module.ParsePage(offset, limit, args...)
+	if err != nil {
+		return 0, []Map{}, erroring(ErrInvalidQuery, err)
+	}
+	rows, err := this.Query(args...)
+	if err != nil {
+		return 0, []Map{}, err
+	}
+	total := int64(len(rows))
+
+	begin := query.Offset
+	if begin > total {
+		begin = total
+	}
+	end := total
+	if query.Limit > 0 && begin+query.Limit < total {
+		end = begin + query.Limit
+	}
+
+	return total, rows[begin:end], nil
+}
+
+// Group 分组统计，返回字段值和 $count 数量
+func (this *memoryTable) Group(field string, args ...Any) ([]Map, error) {
+	rows, err := this.Query(args...)
+	if err != nil {
+		return []Map{}, err
+	}
+	column := ParseColumn(field)
+
+	groups := []Map{}
+	for _, row := range rows {
+		value := memoryField(row, column)
+
+		found := false
+		for _, group := range groups {
+			if memoryEqual(group[field], value) {
+				group["$count"] = group["$count"].(float64) + 1
+				found = true
+				break
+			}
+		}
+		if found == false {
+			groups = append(groups, Map{field: value, "$count": float64(1)})
+		}
+	}
+
+	return groups, nil
+}
+
+// filter 按查询条件过滤并排序，返回的是原始行，调用前需要加锁
+func (this *memoryTable) filter(rows []Map, args ...Any) ([]Map, error) {
+	query, err := module.ParseTree(args...)
+	if err != nil {
+		return nil, erroring(ErrInvalidQuery, err)
+	}
+	if query.Raw != "" {
+		return nil, erroring(ErrInvalidQuery, errMemoryRawQuery)
+	}
+
+	results := []Map{}
+	for _, row := range rows {
+		if query.Where == nil || memoryEvaluate(row, query.Where) {
+			results = append(results, row)
+		}
+	}
+
+	if len(query.Sorts) > 0 {
+		//有随机排序的先打乱，比较时跳过随机排序，相同的保持打乱后的顺序
+		for _, order := range query.Sorts {
+			if order.Random {
+				rand.Shuffle(len(results), func(i, j int) {
+					results[i], results[j] = results[j], results[i]
+				})
+				break
+			}
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			for _, order := range query.Sorts {
+				if order.Random {
+					continue
+				}
+				a, b := memorySorting(results[i], order), memorySorting(results[j], order)
+				if order.Nulls != "" && (a == nil) != (b == nil) {
+					//空值的位置不受升降序影响
+					return (a == nil) == (order.Nulls == NullsFirst)
+				}
+				cmp, ok := memoryCompare(a, b)
+				if ok == false || cmp == 0 {
+					continue
+				}
+				if order.Desc {
+					return cmp > 0
+				}
+				return cmp < 0
+			}
+			return false
+		})
+	}
+
+	return results, nil
+}
+
+//---------------------------- view & model ----------------------------
+
+func (this *memoryView) Count(args ...Any) (float64, error) {
+	return this.memoryTable.Count(args...)
+}
+func (this *memoryView) First(args ...Any) (Map, error) {
+	return this.memoryTable.First(args...)
+}
+func (this *memoryView) Query(args ...Any) ([]Map, error) {
+	return this.memoryTable.Query(args...)
+}
+func (this *memoryView) Limit(offset, limit Any, args ...Any) (int64, []Map, error) {
+	return this.memoryTable.Limit(offset, limit, args...)
+}
+func (this *memoryView) Group(field string, args ...Any) ([]Map, error) {
+	return this.memoryTable.Group(field, args...)
+}
+
+func (this *memoryModel) First(args ...Any) (Map, error) {
+	return this.memoryTable.First(args...)
+}
+func (this *memoryModel) Query(args ...Any) ([]Map, error) {
+	return this.memoryTable.Query(args...)
+}
+
+//---------------------------- query ----------------------------
+
+// memoryEvaluate 判断一行是否满足条件
+// 和 Module.Render 生成的SQL语义保持一致
+func memoryEvaluate(row Map, node Node) bool {
+	switch vv := node.(type) {
+	case *Group:
+		if vv.Logic == LogicOr {
+			for _, child := range vv.Nodes {
+				if memoryEvaluate(row, child) {
+					return true
+				}
+			}
+			return len(vv.Nodes) == 0
+		}
+		for _, child := range vv.Nodes {
+			if memoryEvaluate(row, child) == false {
+				return false
+			}
+		}
+		return true
+
+	case *Condition:
+		value := memoryField(row, vv.Column)
+		switch vv.Op {
+		case OpNull:
+			return value == nil
+		case OpNotNull:
+			return value != nil
+		case OpEqual:
+			if vv.Json != "" {
+				//json字段是按文本比较的
+				return value != nil && fmt.Sprintf("%v", value) == fmt.Sprintf("%v", vv.Value)
+			}
+			return memoryEqual(value, vv.Value)
+		}
+		return memoryOperate(value, vv.Op, vv.Value)
+	}
+
+	return false
+}
+
+// memoryOperate 处理操作符
+func memoryOperate(value Any, opKey string, opVal Any) bool {
+	if mode, insensitive, ok := likeing(opKey); ok {
+		if value == nil {
+			return false
+		}
+		text, sub := fmt.Sprintf("%v", value), fmt.Sprintf("%v", opVal)
+		if insensitive {
+			text, sub = strings.ToUpper(text), strings.ToUpper(sub)
+		}
+		switch mode {
+		case LikeLeft:
+			return strings.HasPrefix(text, sub)
+		case LikeRight:
+			return strings.HasSuffix(text, sub)
+		}
+		return strings.Contains(text, sub)
+	}
+
+	switch opKey {
+	case ANY:
+		return memoryContains(memorySlice(value), opVal)
+	case CON:
+		values := memorySlice(value)
+		for _, vv := range memoryList(opVal) {
+			if memoryContains(values, vv) == false {
+				return false
+			}
+		}
+		return true
+	case CONBY:
+		options := memoryList(opVal)
+		for _, vv := range memorySlice(value) {
+			if memoryContains(options, vv) == false {
+				return false
+			}
+		}
+		return true
+	case OR, IN:
+		list := memoryList(opVal)
+		if value == nil {
+			//OR 列表里有 nil 时匹配空值
+			return opKey == OR && memoryContains(list, nil)
+		}
+		return memoryContains(list, value)
+	case NOR:
+		list := memoryList(opVal)
+		if value == nil {
+			return memoryContains(list, nil) == false
+		}
+		return memoryContains(list, value) == false
+	case NIN:
+		//和sql的 NOT IN 一样，空值不匹配
+		return value != nil && memoryContains(memoryList(opVal), value) == false
+	case "=", "==":
+		return memoryEqual(value, opVal)
+	case "!=", "<>":
+		return value != nil && memoryEqual(value, opVal) == false
+	case ">", ">=", "<", "<=":
+		cmp, ok := memoryCompare(value, opVal)
+		if ok == false {
+			return false
+		}
+		switch opKey {
+		case ">":
+			return cmp > 0
+		case ">=":
+			return cmp >= 0
+		case "<":
+			return cmp < 0
+		default:
+			return cmp <= 0
+		}
+	}
+
+	//注册的操作符
+	if operator, ok := module.operator(opKey); ok && operator.Match != nil {
+		return operator.Match(value, opVal)
+	}
+
+	return false
+}
+
+// memoryField 取字段值
+// a.b 表示json子字段，a:1 表示数组下标
+func memoryField(row Map, column Column) Any {
+	if column.Index > 0 {
+		values := memorySlice(row[column.Name])
+		//和postgres保持一致，下标从1开始
+		if column.Index <= len(values) {
+			return values[column.Index-1]
+		}
+		return nil
+	} else if column.Json != "" {
+		if child, ok := row[column.Name].(Map); ok {
+			return child[column.Json]
+		}
+		return nil
+	}
+	return row[column.Name]
+}
+
+// memoryApply 把数据写入行，支持 INC 自增
+func memoryApply(row Map, data Map) {
+	for k, v := range data {
+		if k == INC {
+			if incs, ok := v.(Map); ok {
+				for field, step := range incs {
+					base, _ := memoryNumber(row[field])
+					inc, _ := memoryNumber(step)
+					row[field] = base + inc
+				}
+			}
+			continue
+		}
+		row[k] = memoryCopy(v)
+	}
+}
+
+// memoryList 把条件值转成列表
+func memoryList(value Any) []Any {
+	if value == nil {
+		return []Any{}
+	}
+	if list := memorySlice(value); list != nil {
+		return list
+	}
+	return []Any{value}
+}
+
+// memorySlice 把各种类型的切片转成 []Any，不是切片返回nil
+func memorySlice(value Any) []Any {
+	if value == nil {
+		return nil
+	}
+	if vv, ok := value.([]Any); ok {
+		return vv
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil
+	}
+	if _, ok := value.([]byte); ok {
+		return nil
+	}
+	list := make([]Any, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		list = append(list, rv.Index(i).Interface())
+	}
+	return list
+}
+
+func memoryContains(list []Any, value Any) bool {
+	for _, vv := range list {
+		if memoryEqual(vv, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func memoryEqual(a, b Any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if cmp, ok := memoryCompare(a, b); ok {
+		return cmp == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// memoryCompare 比较两个值，数字、字符串、时间、布尔可以比较
+func memoryCompare(a, b Any) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	if an, ok := memoryNumber(a); ok {
+		if bn, ok := memoryNumber(b); ok {
+			if an < bn {
+				return -1, true
+			} else if an > bn {
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	switch av := a.(type) {
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv), true
+		}
+	case time.Time:
+		if bv, ok := b.(time.Time); ok {
+			if av.Before(bv) {
+				return -1, true
+			} else if av.After(bv) {
+				return 1, true
+			}
+			return 0, true
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			if av == bv {
+				return 0, true
+			} else if bv {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+// memorySorting 排序用的值，按 Cast 转换类型
+// 排序规则只支持 NOCASE，其它的按原值排序
+func memorySorting(row Map, order Sort) Any {
+	value := memoryField(row, order.Column)
+	switch order.Cast {
+	case CastInt, CastFloat:
+		if value == nil && order.Nulls == "" {
+			return float64(0)
+		}
+		if vv, ok := validateCoerce("float", value); ok {
+			value = vv
+		}
+	case CastText:
+		if value != nil {
+			value = fmt.Sprintf("%v", value)
+		}
+	}
+	if text, ok := value.(string); ok && strings.EqualFold(order.Collation, "nocase") {
+		value = strings.ToUpper(text)
+	}
+	return value
+}
+
+func memoryNumber(value Any) (float64, bool) {
+	switch vv := value.(type) {
+	case int:
+		return float64(vv), true
+	case int8:
+		return float64(vv), true
+	case int16:
+		return float64(vv), true
+	case int32:
+		return float64(vv), true
+	case int64:
+		return float64(vv), true
+	case uint:
+		return float64(vv), true
+	case uint8:
+		return float64(vv), true
+	case uint16:
+		return float64(vv), true
+	case uint32:
+		return float64(vv), true
+	case uint64:
+		return float64(vv), true
+	case float32:
+		return float64(vv), true
+	case float64:
+		return vv, true
+	}
+	return 0, false
+}
+
+// memoryClone 深复制，避免外部修改内存里的数据
+func memoryClone(data Map) Map {
+	if data == nil {
+		return nil
+	}
+	item := Map{}
+	for k, v := range data {
+		item[k] = memoryCopy(v)
+	}
+	return item
+}
+
+func memoryCopy(value Any) Any {
+	switch vv := value.(type) {
+	case Map:
+		return memoryClone(vv)
+	case []Map:
+		items := make([]Map, 0, len(vv))
+		for _, m := range vv {
+			items = append(items, memoryClone(m))
+		}
+		return items
+	case []Any:
+		items := make([]Any, 0, len(vv))
+		for _, v := range vv {
+			items = append(items, memoryCopy(v))
+		}
+		return items
+	}
+	return value
+}
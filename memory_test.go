@@ -0,0 +1,301 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	. "github.com/chefsgo/base"
+)
+
+var (
+	memoryOnce sync.Once
+	// memoryConfigs 测试用的连接，其它测试要用别的配置的，在 init 里加上
+	memoryConfigs = Configs{
+		"memory": Config{Driver: "memory"},
+	}
+)
+
+// memoryTesting 测试用的内存连接，每个测试用不同的表
+// 所有的连接只 Connect 一次，names 为空的返回 memory 连接
+func memoryTesting(t *testing.T, names ...string) DataBase {
+	memoryOnce.Do(func() {
+		module.Configs(memoryConfigs, true)
+		module.Connect()
+	})
+	name := "memory"
+	if len(names) > 0 {
+		name = names[0]
+	}
+	return module.Base(name)
+}
+
+// memorySeed 清空表再写入测试数据，主键按顺序从1开始
+func memorySeed(t *testing.T, db DataBase, table string, rows ...Map) {
+	if _, err := db.Table(table).Checked().Delete(); err != nil {
+		t.Fatalf("delete %s: %v", table, err)
+	}
+	for i, row := range rows {
+		row["id"] = int64(i + 1)
+		if _, err := db.Table(table).Checked().Create(row); err != nil {
+			t.Fatalf("create %v: %v", row, err)
+		}
+	}
+}
+
+// memoryIds 按顺序返回行的主键
+func memoryIds(rows []Map) []string {
+	ids := []string{}
+	for _, row := range rows {
+		ids = append(ids, fmt.Sprintf("%v", row["id"]))
+	}
+	return ids
+}
+
+func TestMemoryOperators(t *testing.T) {
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_operators",
+		Map{"name": "Apple", "age": 10, "tags": []Any{"a", "b"}, "info": Map{"city": "bj"}},
+		Map{"name": "banana", "age": 20, "tags": []Any{"b"}, "info": Map{"city": "sh"}},
+		Map{"name": "Cherry_%", "tags": []Any{"a", "c"}},
+		Map{"name": "apple pie", "age": 30, "tags": []Any{"c"}},
+	)
+
+	tests := []struct {
+		name string
+		args []Any
+		ids  []string
+	}{
+		{"equal", []Any{Map{"age": 20}}, []string{"2"}},
+		{"gt", []Any{Map{"age": Map{GT: 10}}}, []string{"2", "4"}},
+		{"range", []Any{Map{"age": Map{GE: 10, LT: 30}}}, []string{"1", "2"}},
+		{"ne", []Any{Map{"age": Map{NE: 20}}}, []string{"1", "4"}},
+		{"in", []Any{Map{"age": Map{IN: []Any{10, 30}}}}, []string{"1", "4"}},
+		{"nin", []Any{Map{"age": Map{NIN: []Any{10, 30}}}}, []string{"2"}},
+		{"or", []Any{Map{"age": Map{OR: []Any{10, nil}}}}, []string{"1", "3"}},
+		{"nor", []Any{Map{"age": Map{NOR: []Any{10, nil}}}}, []string{"2", "4"}},
+		{"any", []Any{Map{"tags": Map{ANY: "a"}}}, []string{"1", "3"}},
+		{"con", []Any{Map{"tags": Map{CON: []Any{"a", "b"}}}}, []string{"1"}},
+		{"conby", []Any{Map{"tags": Map{CONBY: []Any{"a", "b"}}}}, []string{"1", "2"}},
+		{"search", []Any{Map{"name": Map{SEARCH: "apple"}}}, []string{"1", "4"}},
+		{"like", []Any{Map{"name": Map{OpLike: "apple"}}}, []string{"4"}},
+		{"leftlike", []Any{Map{"name": Map{LEFTLIKE: "APP"}}}, []string{"1", "4"}},
+		{"rightlike", []Any{Map{"name": Map{RIGHTLIKE: "_%"}}}, []string{"3"}},
+		{"nil", []Any{Map{"age": NIL}}, []string{"3"}},
+		{"nol", []Any{Map{"age": NOL}}, []string{"1", "2", "4"}},
+		{"json", []Any{Map{"info.city": "bj"}}, []string{"1"}},
+		{"element", []Any{Map{"tags:1": "b"}}, []string{"2"}},
+		{"maps", []Any{Map{"age": 10}, Map{"age": 20}}, []string{"1", "2"}},
+		{"submaps", []Any{Map{"tags": Map{ANY: "b"}, "$or": []Map{{"age": 10}, {"name": "banana"}}}}, []string{"1", "2"}},
+	}
+
+	for _, test := range tests {
+		rows, err := db.Table("test_operators").Checked().Query(test.args...)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if ids := memoryIds(rows); reflect.DeepEqual(ids, test.ids) == false {
+			t.Errorf("%s: got %v, want %v", test.name, ids, test.ids)
+		}
+	}
+}
+
+func TestMemorySorting(t *testing.T) {
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_sorting",
+		Map{"name": "b", "score": 2, "rank": "10"},
+		Map{"name": "A", "score": 3, "rank": "9"},
+		Map{"name": "c", "rank": "100"},
+		Map{"name": "B", "score": 1},
+	)
+
+	tests := []struct {
+		name string
+		args []Any
+		ids  []string
+	}{
+		{"asc", []Any{Map{"name": ASC}}, []string{"2", "4", "1", "3"}},
+		{"desc", []Any{Map{"name": DESC}}, []string{"3", "1", "4", "2"}},
+		{"sorts", []Any{Map{"score": NOL}, Sorts{Asc("score")}}, []string{"4", "1", "2"}},
+		{"nulls first", []Any{Sorts{Asc("score").NullsFirst()}}, []string{"3", "4", "1", "2"}},
+		{"nulls last", []Any{Sorts{Desc("score").NullsLast()}}, []string{"2", "1", "4", "3"}},
+		{"desc nulls first", []Any{Sorts{Desc("score").NullsFirst()}}, []string{"3", "2", "1", "4"}},
+		{"nocase", []Any{Sorts{Asc("name").Collate("NOCASE")}}, []string{"2", "1", "4", "3"}},
+		{"nocase then", []Any{Sorts{Asc("name").Collate("NOCASE"), Asc("score")}}, []string{"2", "4", "1", "3"}},
+		{"cast", []Any{Sorts{Asc("rank").As(CastInt)}}, []string{"4", "2", "1", "3"}},
+		{"sorts first", []Any{Map{"score": ASC}, Sorts{Asc("name").Collate("NOCASE")}}, []string{"2", "4", "1", "3"}},
+	}
+
+	for _, test := range tests {
+		rows, err := db.Table("test_sorting").Checked().Query(test.args...)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if ids := memoryIds(rows); reflect.DeepEqual(ids, test.ids) == false {
+			t.Errorf("%s: got %v, want %v", test.name, ids, test.ids)
+		}
+	}
+}
+
+func TestMemorySavepoint(t *testing.T) {
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_savepoint")
+	table := db.Table("test_savepoint").Checked()
+
+	tests := []struct {
+		name  string
+		steps func()
+		depth int
+		count float64
+	}{
+		{"begin", func() {
+			db.Begin()
+			table.Create(Map{"name": "a"})
+		}, 1, 1},
+		{"savepoint cancel", func() {
+			db.Begin()
+			table.Create(Map{"name": "b"})
+			db.Cancel()
+		}, 1, 1},
+		{"savepoint submit", func() {
+			db.Begin()
+			table.Create(Map{"name": "c"})
+			db.Submit()
+		}, 1, 2},
+		{"submit", func() {
+			db.Submit()
+		}, 0, 2},
+		{"cancel", func() {
+			db.Begin()
+			table.Create(Map{"name": "d"})
+			db.Cancel()
+		}, 0, 2},
+	}
+
+	for _, test := range tests {
+		test.steps()
+		if depth := db.Depth(); depth != test.depth {
+			t.Errorf("%s: depth got %d, want %d", test.name, depth, test.depth)
+		}
+		if count, _ := table.Count(); count != test.count {
+			t.Errorf("%s: count got %v, want %v", test.name, count, test.count)
+		}
+	}
+}
+
+func TestMemoryNestedTransaction(t *testing.T) {
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_nested")
+
+	err := db.Transaction(func(tx DataBase) error {
+		tx.Table("test_nested").Create(Map{"name": "outer"})
+		inner := tx.Transaction(func(tx DataBase) error {
+			tx.Table("test_nested").Create(Map{"name": "inner"})
+			return errors.New("inner failed")
+		})
+		if inner == nil {
+			t.Errorf("inner transaction should fail")
+		}
+		if depth := tx.Depth(); depth != 1 {
+			t.Errorf("depth got %d, want 1", depth)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+
+	rows := db.Table("test_nested").Query(Map{"name": ASC})
+	if len(rows) != 1 || rows[0]["name"] != "outer" {
+		t.Errorf("got %v, want only outer", rows)
+	}
+}
+
+func TestMemoryRandom(t *testing.T) {
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_random", Map{"name": "a"}, Map{"name": "b"}, Map{"name": "c"})
+
+	rows, err := db.Table("test_random").Checked().Query(Map{"name": RAND})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Errorf("got %d rows, want 3", len(rows))
+	}
+}
+
+func TestMemoryCancelIsolation(t *testing.T) {
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_isolation_a")
+	memorySeed(t, db, "test_isolation_b")
+
+	db.Begin()
+	db.Table("test_isolation_a").Create(Map{"name": "rolled back"})
+
+	//另一个连接在事务中间提交的别的表，回滚时不能被还原
+	other := module.Base("memory")
+	other.Table("test_isolation_b").Create(Map{"name": "committed"})
+
+	db.Cancel()
+
+	if count := db.Table("test_isolation_a").Count(); count != 0 {
+		t.Errorf("test_isolation_a count got %v, want 0", count)
+	}
+	if count := db.Table("test_isolation_b").Count(); count != 1 {
+		t.Errorf("test_isolation_b count got %v, want 1", count)
+	}
+}
+
+func TestMemoryUnique(t *testing.T) {
+	module.Table("test_unique", Table{
+		Uniques: []Index{
+			{Name: "test_unique_email", Fields: []string{"email"}},
+			{Name: "test_unique_org_code", Fields: []string{"org", "code"}},
+		},
+	}, true)
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_unique",
+		Map{"email": "a@x", "org": 1, "code": "a"},
+		Map{"email": "b@x", "org": 1, "code": "b"},
+	)
+	table := db.Table("test_unique").Checked()
+
+	tests := []struct {
+		name string
+		data Map
+		ok   bool
+	}{
+		{"duplicate key", Map{"id": 1, "email": "c@x"}, false},
+		{"duplicate email", Map{"email": "a@x"}, false},
+		{"duplicate pair", Map{"org": 1, "code": "a"}, false},
+		{"other pair", Map{"org": 2, "code": "a"}, true},
+		{"nil not unique", Map{"org": 1}, true},
+		{"nil again", Map{"org": 1}, true},
+	}
+	for _, test := range tests {
+		_, err := table.Create(test.data)
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if test.ok == false && (errors.Is(err, ErrDuplicate) == false || errors.Is(err, ErrConflict) == false) {
+			t.Errorf("%s: got %v, want ErrDuplicate", test.name, err)
+		}
+	}
+
+	if _, err := table.Change(Map{"id": 2}, Map{"email": "a@x"}); errors.Is(err, ErrDuplicate) == false {
+		t.Errorf("change: got %v, want ErrDuplicate", err)
+	}
+	if _, err := table.Change(Map{"id": 1}, Map{"email": "a@x", "code": "a"}); err != nil {
+		t.Errorf("change itself: %v", err)
+	}
+
+	//删除之后可以再用
+	table.Delete(Map{"id": 1})
+	if _, err := table.Create(Map{"email": "a@x"}); err != nil {
+		t.Errorf("create after delete: %v", err)
+	}
+}
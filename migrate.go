@@ -0,0 +1,313 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 结构迁移
+// 对比注册的表和数据库中现有的表，生成建表和加字段的语句，由驱动的 DataMigrator 实现
+// 只会新建表、增加字段和索引，数据库中多出来的字段和类型变化只在报告里列出，不会修改
+// 类型变化需要驱动实现 DataTypeMigrator 才能检查
+// 外键只在新建表时创建
+// 连接的 setting 里 migrate 为 true 的，Connect 时自动迁移
+// 表的 setting 里 base 指定连接，没有指定的属于默认连接，migrate 为 false 的不迁移
+
+const (
+	// SchemaCreate 新建表
+	SchemaCreate = "create"
+	// SchemaAdd 增加字段
+	SchemaAdd = "add"
+	// SchemaIndex 增加索引和唯一约束
+	SchemaIndex = "index"
+	// SchemaExtra 数据库中有，但是没有注册的字段，不处理
+	SchemaExtra = "extra"
+	// SchemaType 数据库中的类型和注册的不一致，不处理
+	SchemaType = "type"
+)
+
+var (
+	errMigrateUnsupported = errors.New("Data driver does not support migration.")
+)
+
+type (
+	// DataMigrator 支持结构迁移的驱动，由驱动的 DataBase 实现
+	DataMigrator interface {
+		// Columns 表现有的字段名，表不存在返回nil
+		Columns(schema, table string) ([]string, error)
+		// Indexes 表现有的索引名
+		Indexes(schema, table string) ([]string, error)
+		// Statements 生成变更的语句
+		Statements(change SchemaChange) ([]string, error)
+		// Execute 依次执行语句
+		Execute(statements []string) error
+	}
+
+	// DataTypeMigrator 能检查字段类型的驱动实现
+	DataTypeMigrator interface {
+		// Mismatches 数据库中类型和定义不一致的字段，只检查已经存在的字段
+		Mismatches(config Table) ([]string, error)
+	}
+
+	// SchemaChange 结构变更
+	// Name 为注册的表名，Fields 为新建或增加的字段，Indexes 和 Uniques 为新建的索引
+	// 索引的名称都已经生成好了
+	SchemaChange struct {
+		Name       string   `json:"name"`
+		Action     string   `json:"action"`
+		Table      Table    `json:"table"`
+		Fields     []string `json:"fields"`
+		Indexes    []Index  `json:"indexes"`
+		Uniques    []Index  `json:"uniques"`
+		Statements []string `json:"statements"`
+	}
+)
+
+// DiffSchema 生成连接待执行的结构变更，不执行，用于检查
+func (this *Module) DiffSchema(name string) ([]SchemaChange, error) {
+	inst, err := this.instance(name)
+	if err != nil {
+		return nil, err
+	}
+
+	base := inst.connect.Base()
+	defer base.Close()
+
+	return this.diffing(inst.name, base)
+}
+
+// MigrateSchema 执行连接的结构变更，返回已经执行的变更
+// 多出的字段和类型变化不会执行，也一起返回，方便调用的地方检查
+func (this *Module) MigrateSchema(name string) ([]SchemaChange, error) {
+	inst, err := this.instance(name)
+	if err != nil {
+		return nil, err
+	}
+
+	base := inst.connect.Base()
+	defer base.Close()
+
+	changes, err := this.diffing(inst.name, base)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator := base.(DataMigrator)
+	done := []SchemaChange{}
+	for _, change := range changes {
+		if len(change.Statements) == 0 {
+			if change.Action == SchemaExtra || change.Action == SchemaType {
+				done = append(done, change)
+			}
+			continue
+		}
+		if err := migrator.Execute(change.Statements); err != nil {
+			return done, fmt.Errorf("Failed to migrate %s: %w", change.Name, err)
+		}
+		done = append(done, change)
+	}
+	return done, nil
+}
+
+// diffing 对比所有属于这个连接的表，按表名排序
+// 没有指定连接的表属于默认连接
+func (this *Module) diffing(name string, base DataBase) ([]SchemaChange, error) {
+	migrator, ok := base.(DataMigrator)
+	if ok == false {
+		return nil, errMigrateUnsupported
+	}
+
+	defaultName := this.defaultName()
+	names := []string{}
+	for key, config := range this.tables {
+		if vv, ok := config.Setting["migrate"].(bool); ok && vv == false {
+			continue
+		}
+		bound := defaultName
+		if vv, ok := config.Setting["base"].(string); ok && vv != "" {
+			bound = vv
+		}
+		if bound != name {
+			continue
+		}
+		names = append(names, key)
+	}
+	sort.Strings(names)
+
+	changes := []SchemaChange{}
+	for _, key := range names {
+		items, err := this.schemaDiff(migrator, key, this.tables[key])
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, items...)
+	}
+
+	return changes, nil
+}
+
+// schemaDiff 对比一个表
+func (this *Module) schemaDiff(migrator DataMigrator, key string, config Table) ([]SchemaChange, error) {
+	if config.Table == "" {
+		config.Table = key
+	}
+	if config.Key == "" {
+		config.Key = "id"
+	}
+
+	columns, err := migrator.Columns(config.Schema, config.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes, uniques := schemaIndexes(config)
+
+	items := []SchemaChange{}
+	if columns == nil {
+		items = append(items, SchemaChange{
+			Name: key, Action: SchemaCreate, Table: config, Fields: schemaFields(config),
+			Indexes: indexes, Uniques: uniques,
+		})
+	} else {
+		exists := map[string]bool{}
+		for _, column := range columns {
+			exists[strings.ToLower(column)] = true
+		}
+
+		adds := []string{}
+		for _, field := range schemaFields(config) {
+			if exists[strings.ToLower(field)] == false {
+				adds = append(adds, field)
+			}
+		}
+		if len(adds) > 0 {
+			items = append(items, SchemaChange{Name: key, Action: SchemaAdd, Table: config, Fields: adds})
+		}
+
+		registered := map[string]bool{}
+		for _, field := range schemaFields(config) {
+			registered[strings.ToLower(field)] = true
+		}
+		extras := []string{}
+		for _, column := range columns {
+			if registered[strings.ToLower(column)] == false {
+				extras = append(extras, column)
+			}
+		}
+		if len(extras) > 0 {
+			items = append(items, SchemaChange{Name: key, Action: SchemaExtra, Table: config, Fields: extras})
+		}
+
+		if typer, ok := migrator.(DataTypeMigrator); ok {
+			mismatches, err := typer.Mismatches(config)
+			if err != nil {
+				return nil, err
+			}
+			if len(mismatches) > 0 {
+				sort.Strings(mismatches)
+				items = append(items, SchemaChange{Name: key, Action: SchemaType, Table: config, Fields: mismatches})
+			}
+		}
+
+		names, err := migrator.Indexes(config.Schema, config.Table)
+		if err != nil {
+			return nil, err
+		}
+		exists = map[string]bool{}
+		for _, name := range names {
+			exists[strings.ToLower(name)] = true
+		}
+
+		change := SchemaChange{Name: key, Action: SchemaIndex, Table: config}
+		for _, index := range indexes {
+			if exists[strings.ToLower(index.Name)] == false {
+				change.Indexes = append(change.Indexes, index)
+			}
+		}
+		for _, index := range uniques {
+			if exists[strings.ToLower(index.Name)] == false {
+				change.Uniques = append(change.Uniques, index)
+			}
+		}
+		if len(change.Indexes) > 0 || len(change.Uniques) > 0 {
+			items = append(items, change)
+		}
+	}
+
+	for i, item := range items {
+		if item.Action != SchemaExtra && item.Action != SchemaType {
+			statements, err := migrator.Statements(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i].Statements = statements
+		}
+	}
+
+	return items, nil
+}
+
+// schemaCreating 创建内部使用的表，已经存在的补上缺少的字段和索引
+// 驱动不支持结构迁移的不处理
+func (this *Module) schemaCreating(base DataBase, key string, config Table) error {
+	migrator, ok := base.(DataMigrator)
+	if ok == false {
+		return nil
+	}
+
+	changes, err := this.schemaDiff(migrator, key, config)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if len(change.Statements) > 0 {
+			if err := migrator.Execute(change.Statements); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// migrating Connect 时自动迁移开启了的连接
+func (this *Module) migrating(name string, config Config) {
+	if vv, ok := config.Setting["migrate"].(bool); ok == false || vv == false {
+		return
+	}
+	if _, err := this.MigrateSchema(name); err != nil {
+		panic("Failed to migrate data: " + err.Error())
+	}
+}
+
+// schemaFields 表的字段，主键在最前，其它按名称排序
+func schemaFields(config Table) []string {
+	fields := []string{config.Key}
+	keys := []string{}
+	for key := range config.Fields {
+		if key != config.Key {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return append(fields, keys...)
+}
+
+// schemaIndexes 表的索引和唯一约束，补上名称
+func schemaIndexes(config Table) ([]Index, []Index) {
+	naming := func(items []Index, suffix string) []Index {
+		indexes := []Index{}
+		for _, item := range items {
+			if len(item.Fields) == 0 {
+				continue
+			}
+			if item.Name == "" {
+				item.Name = config.Table + "_" + strings.Join(item.Fields, "_") + suffix
+			}
+			indexes = append(indexes, item)
+		}
+		return indexes
+	}
+	return naming(config.Indexes, "_idx"), naming(config.Uniques, "_key")
+}
@@ -0,0 +1,142 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/chefsgo/base"
+)
+
+// migrateTesting 测试用的 DataMigrator，表结构写在 columns 和 indexes 里
+type migrateTesting struct {
+	DataBase
+	columns    map[string][]string
+	indexes    map[string][]string
+	mismatches map[string][]string
+}
+
+func (this *migrateTesting) Columns(schema, table string) ([]string, error) {
+	return this.columns[table], nil
+}
+func (this *migrateTesting) Indexes(schema, table string) ([]string, error) {
+	return this.indexes[table], nil
+}
+func (this *migrateTesting) Mismatches(config Table) ([]string, error) {
+	return this.mismatches[config.Table], nil
+}
+func (this *migrateTesting) Statements(change SchemaChange) ([]string, error) {
+	return []string{change.Action + " " + change.Table.Table}, nil
+}
+func (this *migrateTesting) Execute(statements []string) error {
+	return nil
+}
+
+func TestMigrateDiff(t *testing.T) {
+	config := Table{
+		Table: "test_migrate_diff",
+		Fields: Vars{
+			"id":    Var{Type: "int"},
+			"name":  Var{Type: "string"},
+			"email": Var{Type: "string"},
+			"age":   Var{Type: "int"},
+		},
+		Indexes: []Index{{Fields: []string{"name"}}},
+		Uniques: []Index{{Fields: []string{"email"}}},
+	}
+
+	tests := []struct {
+		name    string
+		base    *migrateTesting
+		actions []string
+		fields  [][]string
+	}{
+		{"create", &migrateTesting{}, []string{SchemaCreate}, [][]string{{"id", "age", "email", "name"}}},
+		{"same", &migrateTesting{
+			columns: map[string][]string{"test_migrate_diff": {"id", "name", "email", "age"}},
+			indexes: map[string][]string{"test_migrate_diff": {"test_migrate_diff_name_idx", "test_migrate_diff_email_key"}},
+		}, []string{}, [][]string{}},
+		{"drift", &migrateTesting{
+			columns:    map[string][]string{"test_migrate_diff": {"ID", "name", "age", "legacy"}},
+			indexes:    map[string][]string{"test_migrate_diff": {"test_migrate_diff_name_idx"}},
+			mismatches: map[string][]string{"test_migrate_diff": {"name", "age"}},
+		}, []string{SchemaAdd, SchemaExtra, SchemaType, SchemaIndex}, [][]string{{"email"}, {"legacy"}, {"age", "name"}, nil}},
+	}
+
+	for _, test := range tests {
+		changes, err := module.schemaDiff(test.base, "test_migrate_diff", config)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		actions, fields := []string{}, [][]string{}
+		for _, change := range changes {
+			actions = append(actions, change.Action)
+			fields = append(fields, change.Fields)
+			//多出的字段和类型变化不生成语句
+			if drift := change.Action == SchemaExtra || change.Action == SchemaType; drift != (len(change.Statements) == 0) {
+				t.Errorf("%s %s: statements %v", test.name, change.Action, change.Statements)
+			}
+		}
+		if reflect.DeepEqual(actions, test.actions) == false || reflect.DeepEqual(fields, test.fields) == false {
+			t.Errorf("%s: got %v %v, want %v %v", test.name, actions, fields, test.actions, test.fields)
+		}
+	}
+}
+
+func TestMigrateBinding(t *testing.T) {
+	memoryTesting(t)
+	module.Table("test_migrate_default", Table{}, true)
+	module.Table("test_migrate_bound", Table{Setting: Map{"base": "memory_outbox"}}, true)
+	module.Table("test_migrate_skip", Table{Setting: Map{"base": "memory_outbox", "migrate": false}}, true)
+
+	tests := []struct {
+		name string
+		want map[string]bool
+	}{
+		{"memory", map[string]bool{"test_migrate_default": true, "test_migrate_bound": false, "test_migrate_skip": false}},
+		{"memory_outbox", map[string]bool{"test_migrate_default": false, "test_migrate_bound": true, "test_migrate_skip": false}},
+	}
+
+	for _, test := range tests {
+		changes, err := module.diffing(test.name, &migrateTesting{})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		found := map[string]bool{}
+		for _, change := range changes {
+			found[change.Name] = true
+		}
+		for table, want := range test.want {
+			if found[table] != want {
+				t.Errorf("%s %s: got %v, want %v", test.name, table, found[table], want)
+			}
+		}
+	}
+
+	if _, err := module.DiffSchema("memory"); err != errMigrateUnsupported {
+		t.Errorf("memory: got %v, want errMigrateUnsupported", err)
+	}
+}
+
+func TestMigrateIndexes(t *testing.T) {
+	indexes, uniques := schemaIndexes(Table{
+		Table: "test_migrate_index",
+		Indexes: []Index{
+			{Fields: []string{"org", "created"}},
+			{Name: "custom", Fields: []string{"name"}},
+			{Name: "empty"},
+		},
+		Uniques: []Index{{Fields: []string{"email"}}},
+	})
+
+	want := []Index{
+		{Name: "test_migrate_index_org_created_idx", Fields: []string{"org", "created"}},
+		{Name: "custom", Fields: []string{"name"}},
+	}
+	if reflect.DeepEqual(indexes, want) == false {
+		t.Errorf("indexes: got %v, want %v", indexes, want)
+	}
+	if reflect.DeepEqual(uniques, []Index{{Name: "test_migrate_index_email_key", Fields: []string{"email"}}}) == false {
+		t.Errorf("uniques: got %v", uniques)
+	}
+}
@@ -0,0 +1,292 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	. "github.com/chefsgo/base"
+)
+
+// 版本迁移
+// 用 Register 注册 Migration，按 Version 从小到大执行，执行过的记录在每个连接的历史表里
+// 每个迁移和它的历史记录在同一个事务里，失败的回滚，不影响之前已经完成的
+// Base 为空的迁移在所有连接上执行，历史表名在 setting 里用 migration 配置，默认 migration
+// 历史表的定义不注册到表里，不参与自动结构迁移，和注册的表重名的 Connect 时报错
+
+const (
+	defaultMigration = "migration"
+)
+
+var (
+	errMigrationIrreversible = errors.New("Data migration can not be rolled back")
+	errMigrationTable        = errors.New("Data migration table conflicts with a registered table")
+)
+
+type (
+	// Migration 版本迁移，Version 不能重复
+	Migration struct {
+		Name    string               `json:"name"`
+		Text    string               `json:"text"`
+		Version int64                `json:"version"`
+		Base    string               `json:"base"`
+		Up      func(DataBase) error `json:"-"`
+		Down    func(DataBase) error `json:"-"`
+	}
+
+	// MigrationStatus 迁移的状态
+	// 历史表里有，但是没有注册的，Missing 为 true
+	MigrationStatus struct {
+		Name    string    `json:"name"`
+		Version int64     `json:"version"`
+		Applied bool      `json:"applied"`
+		Time    time.Time `json:"time"`
+		Missing bool      `json:"missing"`
+	}
+)
+
+// Migration 注册版本迁移
+func (this *Module) Migration(name string, config Migration, override bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if config.Up == nil {
+		panic("Invalid data migration: " + name)
+	}
+	if config.Name == "" {
+		config.Name = name
+	}
+	for key, vv := range this.migrations {
+		if key != name && vv.Version == config.Version {
+			panic(fmt.Sprintf("Duplicate data migration version %d: %s, %s", config.Version, key, name))
+		}
+	}
+
+	if override {
+		this.migrations[name] = config
+	} else {
+		if _, ok := this.migrations[name]; ok == false {
+			this.migrations[name] = config
+		}
+	}
+}
+
+// migrationTable 历史表名
+func (this *Module) migrationTable(config Config) string {
+	if vv, ok := config.Setting["migration"].(string); ok && vv != "" {
+		return vv
+	}
+	return defaultMigration
+}
+
+// migrationConfig 历史表的定义
+func migrationConfig(name string) Table {
+	return Table{
+		Name: "迁移记录", Table: name, Key: "version",
+		Fields: Vars{
+			"version": Var{Type: "int"},
+			"name":    Var{Type: "string"},
+			"applied": Var{Type: "datetime"},
+		},
+	}
+}
+
+// migrationing 检查历史表名，有迁移的连接不能和注册的表重名
+// 驱动按表名找定义，重名的话会用错主键和字段
+func (this *Module) migrationing(name string, config Config) error {
+	if len(this.versions(name)) == 0 {
+		return nil
+	}
+	table := this.migrationTable(config)
+	if _, ok := this.tables[table]; ok {
+		return fmt.Errorf("%w: %s, set another name with migration in setting", errMigrationTable, table)
+	}
+	return nil
+}
+
+// versions 连接上的迁移，按版本排序
+func (this *Module) versions(name string) []Migration {
+	migrations := []Migration{}
+	for _, migration := range this.migrations {
+		if migration.Base == "" || migration.Base == name {
+			migrations = append(migrations, migration)
+		}
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations
+}
+
+// history 已经执行的版本，没有历史表的先创建
+func (this *Module) history(base *moduleBase) (map[int64]Map, error) {
+	table := this.migrationTable(base.config)
+	if err := this.schemaCreating(base.base, table, migrationConfig(table)); err != nil {
+		return nil, err
+	}
+
+	items, err := base.base.Table(table).Checked().Query()
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int64]Map{}
+	for _, item := range items {
+		if version, ok := migrationVersion(item["version"]); ok {
+			applied[version] = item
+		}
+	}
+	return applied, nil
+}
+
+// Migrate 执行所有未执行的迁移，返回执行的数量
+func (this *Module) Migrate(name string) (int, error) {
+	base, err := this.migrationBase(name)
+	if err != nil {
+		return 0, err
+	}
+	defer base.Close()
+
+	applied, err := this.history(base)
+	if err != nil {
+		return 0, err
+	}
+
+	table := this.migrationTable(base.config)
+	count := 0
+	for _, migration := range this.versions(base.name) {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err := base.Transaction(func(tx DataBase) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			_, err := base.base.Table(table).Checked().Create(Map{
+				"version": migration.Version, "name": migration.Name, "applied": time.Now(),
+			})
+			return err
+		}, TxOption{Attempts: 1})
+		if err != nil {
+			return count, fmt.Errorf("Failed to migrate %s: %w", migration.Name, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Rollback 回滚最近执行的 steps 个迁移，返回回滚的数量
+// 遇到没有 Down 或是没有注册的迁移时停止
+func (this *Module) Rollback(name string, steps int) (int, error) {
+	base, err := this.migrationBase(name)
+	if err != nil {
+		return 0, err
+	}
+	defer base.Close()
+
+	applied, err := this.history(base)
+	if err != nil {
+		return 0, err
+	}
+
+	registered := map[int64]Migration{}
+	for _, migration := range this.versions(base.name) {
+		registered[migration.Version] = migration
+	}
+
+	versions := []int64{}
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] > versions[j]
+	})
+
+	table := this.migrationTable(base.config)
+	count := 0
+	for _, version := range versions {
+		if count >= steps {
+			break
+		}
+
+		migration, ok := registered[version]
+		if ok == false || migration.Down == nil {
+			return count, fmt.Errorf("%w: %d", errMigrationIrreversible, version)
+		}
+
+		err := base.Transaction(func(tx DataBase) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			_, err := base.base.Table(table).Checked().Delete(Map{"version": version})
+			return err
+		}, TxOption{Attempts: 1})
+		if err != nil {
+			return count, fmt.Errorf("Failed to rollback %s: %w", migration.Name, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// MigrationStatus 所有迁移的状态，按版本排序
+func (this *Module) MigrationStatus(name string) ([]MigrationStatus, error) {
+	base, err := this.migrationBase(name)
+	if err != nil {
+		return nil, err
+	}
+	defer base.Close()
+
+	applied, err := this.history(base)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []MigrationStatus{}
+	for _, migration := range this.versions(base.name) {
+		status := MigrationStatus{Name: migration.Name, Version: migration.Version}
+		if item, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.Time, _ = item["applied"].(time.Time)
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for version, item := range applied {
+		status := MigrationStatus{Version: version, Applied: true, Missing: true}
+		status.Name, _ = item["name"].(string)
+		status.Time, _ = item["applied"].(time.Time)
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// migrationBase 迁移使用的DataBase，迁移函数拿到的是包装过的
+func (this *Module) migrationBase(name string) (*moduleBase, error) {
+	base, err := this.GetBase(name)
+	if err != nil {
+		return nil, err
+	}
+	return base.(*moduleBase), nil
+}
+
+// migrationVersion 历史表里的版本号，有的驱动读出来是别的数字类型
+func migrationVersion(value Any) (int64, bool) {
+	switch vv := value.(type) {
+	case int64:
+		return vv, true
+	case int:
+		return int64(vv), true
+	case float64:
+		return int64(vv), true
+	}
+	return 0, false
+}
@@ -0,0 +1,131 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	. "github.com/chefsgo/base"
+)
+
+func init() {
+	memoryConfigs["memory_migration"] = Config{Driver: "memory", Setting: Map{"migration": "test_migration_history"}}
+}
+
+// migrationTesting 注册测试用的迁移，Up 和 Down 写入和删除一行数据
+func migrationTesting(name string, version int64, failed bool) {
+	module.Migration(name, Migration{
+		Version: version, Base: "memory_migration",
+		Up: func(tx DataBase) error {
+			tx.Table("test_migration").Create(Map{"name": name})
+			if failed {
+				return errors.New("failed")
+			}
+			return tx.Erred()
+		},
+		Down: func(tx DataBase) error {
+			tx.Table("test_migration").Delete(Map{"name": name})
+			return tx.Erred()
+		},
+	}, true)
+}
+
+// migrationNames 表里的数据，按名称排序
+func migrationNames(db DataBase) []string {
+	names := []string{}
+	for _, row := range db.Table("test_migration").Query(Map{"name": ASC}) {
+		names = append(names, row["name"].(string))
+	}
+	return names
+}
+
+func TestMigration(t *testing.T) {
+	db := memoryTesting(t, "memory_migration")
+	memorySeed(t, db, "test_migration")
+	migrationTesting("test_migration_one", 1801, false)
+	migrationTesting("test_migration_two", 1802, false)
+
+	if count, err := module.Migrate("memory_migration"); err != nil || count != 2 {
+		t.Fatalf("migrate: got %d %v", count, err)
+	}
+	if count, err := module.Migrate("memory_migration"); err != nil || count != 0 {
+		t.Errorf("migrate again: got %d %v", count, err)
+	}
+	if names := migrationNames(db); reflect.DeepEqual(names, []string{"test_migration_one", "test_migration_two"}) == false {
+		t.Errorf("migrated: got %v", names)
+	}
+
+	//历史表不注册到表里，其它连接看不到
+	if _, ok := module.tables["test_migration_history"]; ok {
+		t.Errorf("history table should not be registered")
+	}
+	if count := db.Table("test_migration_history").Count(); count != 2 {
+		t.Errorf("history: got %v, want 2", count)
+	}
+
+	//失败的迁移和它的数据一起回滚
+	migrationTesting("test_migration_three", 1803, true)
+	if count, err := module.Migrate("memory_migration"); err == nil || count != 0 {
+		t.Errorf("failed migrate: got %d %v", count, err)
+	}
+	if names := migrationNames(db); len(names) != 2 {
+		t.Errorf("failed migrate: got %v", names)
+	}
+
+	migrationTesting("test_migration_three", 1803, false)
+	if count, err := module.Migrate("memory_migration"); err != nil || count != 1 {
+		t.Errorf("migrate fixed: got %d %v", count, err)
+	}
+
+	db.Table("test_migration_history").Create(Map{"version": 1799, "name": "test_migration_gone"})
+	statuses, err := module.MigrationStatus("memory_migration")
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	got := []MigrationStatus{}
+	for _, status := range statuses {
+		got = append(got, MigrationStatus{Name: status.Name, Version: status.Version, Applied: status.Applied, Missing: status.Missing})
+	}
+	want := []MigrationStatus{
+		{Name: "test_migration_gone", Version: 1799, Applied: true, Missing: true},
+		{Name: "test_migration_one", Version: 1801, Applied: true},
+		{Name: "test_migration_two", Version: 1802, Applied: true},
+		{Name: "test_migration_three", Version: 1803, Applied: true},
+	}
+	if reflect.DeepEqual(got, want) == false {
+		t.Errorf("status: got %v, want %v", got, want)
+	}
+
+	if count, err := module.Rollback("memory_migration", 2); err != nil || count != 2 {
+		t.Errorf("rollback: got %d %v", count, err)
+	}
+	if names := migrationNames(db); reflect.DeepEqual(names, []string{"test_migration_one"}) == false {
+		t.Errorf("rolled back: got %v", names)
+	}
+
+	//没有注册的迁移没法回滚
+	if count, err := module.Rollback("memory_migration", 5); errors.Is(err, errMigrationIrreversible) == false || count != 1 {
+		t.Errorf("irreversible: got %d %v", count, err)
+	}
+}
+
+func TestMigrationTable(t *testing.T) {
+	memoryTesting(t)
+	config := Config{Driver: "memory", Setting: Map{"migration": "test_migration_clash"}}
+	module.Migration("test_migration_clash", Migration{
+		Version: 1810, Base: "test_migration_clash",
+		Up: func(DataBase) error { return nil },
+	}, true)
+
+	if err := module.migrationing("test_migration_clash", config); err != nil {
+		t.Errorf("no clash: got %v", err)
+	}
+	module.Table("test_migration_clash", Table{}, true)
+	if err := module.migrationing("test_migration_clash", config); errors.Is(err, errMigrationTable) == false {
+		t.Errorf("clash: got %v, want errMigrationTable", err)
+	}
+	//没有迁移的连接不检查
+	if err := module.migrationing("memory", config); err != nil {
+		t.Errorf("no migrations: got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	. "github.com/chefsgo/base"
+)
+
+func TestModelReference(t *testing.T) {
+	module.View("test_ref_stats", View{View: "test_ref_stat", Key: "customer_id"}, true)
+	module.Model("test_ref_order", Model{Model: "test_ref_order", Fields: Vars{
+		"customer_id": Var{Type: "int"},
+		"customer":    Var{Type: "json", Setting: Map{"table": "test_ref_customer", "field": "customer_id"}},
+		"items":       Var{Type: "[json]", Setting: Map{"table": "test_ref_item", "key": "order_id"}},
+		"stats":       Var{Type: "json", Setting: Map{"view": "test_ref_stats", "field": "customer_id"}},
+	}}, true)
+
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_ref_customer", Map{"name": "alice"}, Map{"name": "bob"})
+	memorySeed(t, db, "test_ref_stat", Map{"customer_id": 1, "orders": 2})
+	memorySeed(t, db, "test_ref_item",
+		Map{"order_id": 1, "sku": "a"}, Map{"order_id": 1, "sku": "b"}, Map{"order_id": 2, "sku": "c"},
+	)
+	memorySeed(t, db, "test_ref_order", Map{"customer_id": 1}, Map{"customer_id": 1}, Map{})
+
+	orders, err := db.Model("test_ref_order").Checked().Query(Map{"id": ASC})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+
+	tests := []struct {
+		customer Any
+		items    []string
+		stats    Any
+	}{
+		{"alice", []string{"1", "2"}, 2},
+		{"alice", []string{"3"}, 2},
+		{nil, []string{}, nil},
+	}
+	for i, test := range tests {
+		order := orders[i]
+		var customer, stats Any
+		if vv, ok := order["customer"].(Map); ok {
+			customer = vv["name"]
+		}
+		if vv, ok := order["stats"].(Map); ok {
+			stats = vv["orders"]
+		}
+		if customer != test.customer || stats != test.stats {
+			t.Errorf("order %d: got %v %v, want %v %v", i+1, order["customer"], order["stats"], test.customer, test.stats)
+		}
+		if ids := memoryIds(order["items"].([]Map)); reflect.DeepEqual(ids, test.items) == false {
+			t.Errorf("order %d items: got %v, want %v", i+1, ids, test.items)
+		}
+	}
+
+	//引用到同一行的，每个拿到自己的一份
+	orders[0]["customer"].(Map)["name"] = "changed"
+	if orders[1]["customer"].(Map)["name"] != "alice" {
+		t.Errorf("referenced rows are shared: got %v", orders[1]["customer"])
+	}
+
+	order, err := db.Model("test_ref_order").Checked().First(Map{"id": 2})
+	if err != nil || order["customer"].(Map)["name"] != "alice" || len(order["items"].([]Map)) != 1 {
+		t.Errorf("first: got %v %v", order, err)
+	}
+}
+
+func TestModelReferenceInvalid(t *testing.T) {
+	module.Model("test_ref_invalid", Model{Model: "test_ref_order", Fields: Vars{
+		"items": Var{Type: "[json]", Setting: Map{"table": "test_ref_item"}},
+	}}, true)
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_ref_order", Map{})
+
+	if _, err := db.Model("test_ref_invalid").Checked().Query(); errors.Is(err, ErrInvalidQuery) == false {
+		t.Errorf("got %v, want ErrInvalidQuery", err)
+	}
+}
@@ -1,9 +1,12 @@
 package data
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	. "github.com/chefsgo/base"
 	"github.com/chefsgo/chef"
@@ -15,18 +18,23 @@ func init() {
 
 var (
 	module = &Module{
-		configs:   make(map[string]Config, 0),
-		drivers:   make(map[string]Driver, 0),
-		instances: make(map[string]Instance, 0),
-		tables:    make(map[string]Table, 0),
-		views:     make(map[string]View, 0),
-		models:    make(map[string]Model, 0),
+		configs:    make(map[string]Config, 0),
+		drivers:    make(map[string]Driver, 0),
+		instances:  make(map[string]Instance, 0),
+		tables:     make(map[string]Table, 0),
+		views:      make(map[string]View, 0),
+		models:     make(map[string]Model, 0),
+		dialects:   make(map[string]Dialect, 0),
+		watchers:   make(map[string]Watcher, 0),
+		serials:    make(map[string]SerialProvider, 0),
+		migrations: make(map[string]Migration, 0),
+		operators:  make(map[string]Operator, 0),
 	}
 )
 
 type (
 	Module struct {
-		mutex sync.Mutex
+		mutex sync.RWMutex
 
 		// 几项运行状态
 		connected, initialized, launched bool
@@ -38,6 +46,13 @@ type (
 		views  map[string]View
 		models map[string]Model
 
+		dialects  map[string]Dialect
+		watchers  map[string]Watcher
+		serials   map[string]SerialProvider
+		operators map[string]Operator
+
+		migrations map[string]Migration
+
 		//连接
 		instances map[string]Instance
 	}
@@ -48,11 +63,22 @@ type (
 		Url     string
 		Serial  string
 		Setting Map
+
+		//序列的实现，默认 table
+		SerialProvider string
+
+		//只读副本的地址和选择策略
+		Replicas []string
+		Routing  string
+
+		//没有 chef.DEFAULT 连接时，作为默认连接
+		Default bool
 	}
 	Instance struct {
 		name    string
 		config  Config
 		connect Connect
+		router  *replicaRouter
 	}
 )
 
@@ -97,23 +123,113 @@ func (this *Module) Configs(config Configs, override bool) {
 }
 
 //Instance
+//找不到连接会panic，需要错误的请用 instance
 func (this *Module) Instance(names ...string) Instance {
-	if len(names) > 0 {
-		if inst, ok := module.instances[names[0]]; ok {
-			return inst
-		}
+	inst, err := this.instance(names...)
+	if err != nil {
+		panic(err)
+	}
+	return inst
+}
+
+// instance 获取连接
+// 没有指定名称时，优先使用 chef.DEFAULT，然后是配置了 default 的连接
+// 都没有的话按名称排序取第一个，保证每次启动都是同一个
+func (this *Module) instance(names ...string) (Instance, error) {
+	name := ""
+	if len(names) > 0 && names[0] != "" {
+		name = names[0]
 	} else {
-		for _, val := range this.instances {
-			return val
+		name = this.defaultName()
+	}
+
+	if inst, ok := this.instances[name]; ok {
+		return inst, nil
+	}
+	return Instance{}, fmt.Errorf("%w %s", errInvalidDataConnection, name)
+}
+
+// defaultName 默认连接的名称
+func (this *Module) defaultName() string {
+	if _, ok := this.instances[chef.DEFAULT]; ok {
+		return chef.DEFAULT
+	}
+
+	names := []string{}
+	for name := range this.instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if this.instances[name].config.Default {
+			return name
 		}
 	}
-	panic("Invalid data connection.")
+	if len(names) > 0 {
+		return names[0]
+	}
+	return chef.DEFAULT
 }
 
 //返回数据Base对象
+//包装一层，校验等公共处理在模块里完成
 func (this *Module) Base(names ...string) DataBase {
-	inst := module.Instance(names...)
-	return inst.connect.Base()
+	base, err := this.GetBase(names...)
+	if err != nil {
+		panic(err)
+	}
+	return base
+}
+
+// GetBase 返回数据Base对象，找不到连接返回错误
+func (this *Module) GetBase(names ...string) (DataBase, error) {
+	inst, err := this.instance(names...)
+	if err != nil {
+		return nil, err
+	}
+	return &moduleBase{
+		name: inst.name, config: inst.config,
+		base: inst.connect.Base(), router: inst.router,
+	}, nil
+}
+
+// timeout 连接的默认查询超时，在 setting 里配置 timeout
+// 字符串按 time.ParseDuration 解析，数字为毫秒，没有配置返回0
+func (this *Module) timeout(config Config) time.Duration {
+	if duration, ok := settingDuration(config.Setting, "timeout", time.Millisecond); ok {
+		return duration
+	}
+	return 0
+}
+
+// settingDuration 读取 setting 里的时间配置
+// 字符串按 time.ParseDuration 解析，数字以 unit 为单位，没有配置或是格式不对的返回 false
+func settingDuration(setting Map, key string, unit time.Duration) (time.Duration, bool) {
+	switch vv := setting[key].(type) {
+	case string:
+		if duration, err := time.ParseDuration(vv); err == nil {
+			return duration, true
+		}
+	case int:
+		return unit * time.Duration(vv), true
+	case int64:
+		return unit * time.Duration(vv), true
+	case float64:
+		return time.Duration(vv * float64(unit)), true
+	case time.Duration:
+		return vv, true
+	}
+	return 0, false
+}
+
+// timeouting 给上下文加上默认的查询超时
+// 上下文已经有更早的截止时间的，以上下文为准
+func (this *Module) timeouting(ctx context.Context, config Config) (context.Context, context.CancelFunc) {
+	if timeout := this.timeout(config); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return ctx, func() {}
 }
 
 //----------------------------------------------------------------------
@@ -124,507 +240,293 @@ func (this *Module) Base(names ...string) DataBase {
 // 所有参数使用问号(?)表示
 // postgres驱动需要自行处理转成 $1,$2这样的
 // oracle驱动需要自行处理转成 :1 :2这样的
+// 驱动注册了方言的，请使用 ParseWith 直接生成方言的SQL
 //mongodb不适用，需驱动自己实现
 func (this *Module) Parse(args ...Any) (string, []Any, string, error) {
+	return this.ParseWith(&defaultDialect{}, args...)
+}
 
-	if len(args) > 0 {
+// ParseWith 按方言解析查询
+func (this *Module) ParseWith(dialect Dialect, args ...Any) (string, []Any, string, error) {
+	query, err := this.ParseTree(args...)
+	if err != nil {
+		return "", nil, "", err
+	}
+	return this.Render(dialect, query)
+}
 
-		//如果直接写sql
-		if v, ok := args[0].(string); ok {
-			sql := v
-			params := []interface{}{}
-			orderBy := ""
+// Render 把语法树按方言生成SQL
+// 返回条件，参数和排序，分页由驱动自行处理
+func (this *Module) Render(dialect Dialect, query *Query) (string, []Any, string, error) {
+	//如果直接写sql，sql里没有排序才用 Sorts
+	if query.Raw != "" {
+		if query.RawOrder == "" && len(query.Sorts) > 0 {
+			return query.Raw, query.Args, this.ordering(dialect, query.Sorts), nil
+		}
+		return query.Raw, query.Args, query.RawOrder, nil
+	}
 
-			for i, arg := range args {
-				if i > 0 {
-					params = append(params, arg)
+	values := []Any{}
+	where := ""
+	if query.Where != nil {
+		if query.Where.Logic == LogicOr {
+			//最外层的或不用括号
+			querys := []string{}
+			for _, node := range query.Where.Nodes {
+				if sql := this.rendering(dialect, &values, node); sql != "" {
+					querys = append(querys, sql)
 				}
 			}
+			where = strings.Join(querys, " OR ")
+		} else {
+			where = this.rendering(dialect, &values, query.Where)
+		}
+	}
+	if where == "" {
+		where = "1=1"
+	}
 
-			//这里要处理一下，把order提取出来
-			//先拿到 order by 的位置
-			i := strings.Index(strings.ToLower(sql), "order by")
-			if i >= 0 {
-				orderBy = sql[i:]
-				sql = sql[:i]
-			}
+	return where, values, this.ordering(dialect, query.Sorts), nil
+}
 
-			return sql, params, orderBy, nil
+// ordering 按顺序生成排序
+func (this *Module) ordering(dialect Dialect, sorts []Sort) string {
+	orders := []string{}
+	for _, sort := range sorts {
+		orders = append(orders, this.orderby(dialect, sort))
+	}
 
-		} else {
+	orderStr := ""
+	if len(orders) > 0 {
+		orderStr = fmt.Sprintf("ORDER BY %s", strings.Join(orders, ","))
+	}
+	return orderStr
+}
 
-			maps := []Map{}
-			for _, v := range args {
-				if m, ok := v.(Map); ok {
-					maps = append(maps, m)
-				}
-				//如果直接是[]Map，应该算OR处理啊，暂不处理这个
-			}
+// orderby 排序处理，按 Cast 转换类型，按 Collation 排序规则
+// 转换成数字又没有指定空值顺序的，空值当作0
+func (this *Module) orderby(dialect Dialect, sort Sort) string {
+	if sort.Random {
+		return fmt.Sprintf(`%s ASC`, dialect.Random())
+	}
 
-			querys, values, orders := module.parsing(maps...)
+	field := this.fieldby(dialect, sort.Column)
+	if sort.Cast != "" {
+		field = dialect.Cast(field, sort.Cast)
+		if sort.Nulls == "" && (sort.Cast == CastInt || sort.Cast == CastFloat) {
+			field = fmt.Sprintf(`COALESCE(%s, 0)`, field)
+		}
+	}
+	if sort.Collation != "" {
+		field = dialect.Collate(field, sort.Collation)
+	}
 
-			orderStr := ""
-			if len(orders) > 0 {
-				orderStr = fmt.Sprintf("ORDER BY %s", strings.Join(orders, ","))
-			}
+	return dialect.Order(field, sort.Desc, sort.Nulls)
+}
 
-			//sql := fmt.Sprintf("%s %s", strings.Join(querys, " OR "), orderStr)
+// fieldby 字段名处理
+// 包含.应该是处理成json
+// 包含:就处理成数组
+func (this *Module) fieldby(dialect Dialect, column Column) string {
+	if column.Index > 0 {
+		return dialect.Element(dialect.Quote(column.Name), column.Index)
+	} else if column.Json != "" {
+		return dialect.Json(dialect.Quote(column.Name), column.Json)
+	}
+	return dialect.Quote(column.Name)
+}
 
-			if len(querys) == 0 {
-				querys = append(querys, "1=1")
-			}
+// binding 绑定参数，返回占位符
+func (this *Module) binding(dialect Dialect, values *[]Any, value Any) string {
+	*values = append(*values, value)
+	return dialect.Placeholder(len(*values))
+}
 
-			return strings.Join(querys, " OR "), values, orderStr, nil
+// arraying 把数组参数拆开，空数组返回一个0，和原来的处理保持一致
+// 第二个返回值表示是否整数数组
+func (this *Module) arraying(value Any) ([]Any, bool) {
+	items := []Any{}
+	integer := false
+	switch vs := value.(type) {
+	case []int:
+		integer = true
+		for _, v := range vs {
+			items = append(items, v)
 		}
-	} else {
-		return "1=1", []Any{}, "", nil
+	case []int64:
+		integer = true
+		for _, v := range vs {
+			items = append(items, v)
+		}
+	case []string:
+		for _, v := range vs {
+			items = append(items, v)
+		}
+	case []Any:
+		for _, v := range vs {
+			items = append(items, v)
+		}
+	default:
+		return []Any{vs}, false
 	}
-}
 
-func (this *Module) orderby(key string) string {
-	dots := strings.Split(key, ".")
-	if len(dots) > 1 {
-		return fmt.Sprintf(`COALESCE(("%s"->'%s')::float8, 0)`, dots[0], dots[1])
+	if len(items) == 0 {
+		return []Any{0}, false
 	}
-	return key
+	return items, integer
 }
 
-// func (this *Module) fieldby(key string) string {
-// 	dots := strings.Split(key, ".")
-// 	if len(dots) > 1 {
-// 		return fmt.Sprintf(`"%s"->'%s'`, dots[0], dots[1])
-// 	}
-// 	return key
-// }
+//注意，这个是实际的生成，支持递归
+//参数直接写入values，保证占位符的顺序
+func (this *Module) rendering(dialect Dialect, values *[]Any, node Node) string {
 
-//注意，这个是实际的解析，支持递归
-func (this *Module) parsing(args ...Map) ([]string, []interface{}, []string) {
+	bind := func(value Any) string {
+		return this.binding(dialect, values, value)
+	}
 
-	querys := []string{}
-	values := make([]interface{}, 0)
-	orders := []string{}
+	switch vv := node.(type) {
+	case *Group:
+		querys := []string{}
+		for _, child := range vv.Nodes {
+			if sql := this.rendering(dialect, values, child); sql != "" {
+				querys = append(querys, sql)
+			}
+		}
+		if len(querys) == 0 {
+			return ""
+		}
+		return fmt.Sprintf("(%s)", strings.Join(querys, " "+vv.Logic+" "))
+
+	case *Condition:
+		k := this.fieldby(dialect, vv.Column)
+		opKey, opVal := vv.Op, vv.Value
+
+		if opKey == OpNull {
+			return fmt.Sprintf(`%s IS NULL`, k)
+		} else if opKey == OpNotNull {
+			//不为空值
+			return fmt.Sprintf(`%s IS NOT NULL`, k)
+		} else if opKey == OpEqual {
+			//json子字段是按文本比较的
+			if vv.Json != "" {
+				return fmt.Sprintf(`%s = %s`, k, bind(fmt.Sprintf("%v", opVal)))
+			}
+			return fmt.Sprintf(`%s = %s`, k, bind(opVal))
+
+		} else if mode, insensitive, ok := likeing(opKey); ok {
+			//匹配的值转义后做为参数
+			pattern := dialect.Pattern(fmt.Sprintf("%v", opVal), mode, insensitive)
+			return dialect.Like(k, bind(pattern), insensitive)
+		} else if opKey == ANY {
+			return dialect.Any(k, bind(opVal))
+		} else if opKey == CON || opKey == CONBY {
+			// array contains array @>
+			// array contains by array <@
+
+			realArgs := []string{}
+			items, integer := this.arraying(opVal)
+			for _, item := range items {
+				if integer {
+					realArgs = append(realArgs, dialect.Cast(bind(item), CastInt))
+				} else {
+					realArgs = append(realArgs, bind(item))
+				}
+			}
 
-	//否则是多个map,单个为 与, 多个为 或
-	for _, m := range args {
-		ands := []string{}
-
-		for k, v := range m {
-
-			// 字段名处理
-			// 包含.应该是处理成json
-			// 包含:就处理成数组
-			jsoned := false
-			if dots := strings.Split(k, ":"); len(dots) >= 2 {
-				k = fmt.Sprintf(`%v%v%v[%v]`, DELIMS, dots[0], DELIMS, dots[1])
-			} else if dots := strings.Split(k, "."); len(dots) >= 2 {
-				//"%s"->'%s'
-				jsoned = true
-				k = fmt.Sprintf(`%v%v%v->>'%v'`, DELIMS, dots[0], DELIMS, dots[1])
-			} else {
-				k = fmt.Sprintf(`%v%v%v`, DELIMS, k, DELIMS)
+			if opKey == CON {
+				return dialect.Contains(k, realArgs)
 			}
+			return dialect.Contained(k, realArgs)
+
+		} else if opKey == OR {
 
-			//如果值是ASC,DESC，表示是排序
-			//if ov,ok := v.(string); ok && (ov==ASC || ov==DESC) {
-			if v == ASC {
-				//正序
-				orders = append(orders, fmt.Sprintf(`%s ASC`, module.orderby(k)))
-			} else if v == DESC {
-				//倒序
-				orders = append(orders, fmt.Sprintf(`%s DESC`, module.orderby(k)))
-
-			} else if v == RAND {
-				//随机排序
-				orders = append(orders, fmt.Sprintf(`%s ASC`, RANDBY))
-
-			} else if v == nil {
-				ands = append(ands, fmt.Sprintf(`%s IS NULL`, k))
-			} else if v == NIL {
-				ands = append(ands, fmt.Sprintf(`%s IS NULL`, k))
-			} else if v == NOL {
-				//不为空值
-				ands = append(ands, fmt.Sprintf(`%s IS NOT NULL`, k))
-				/*
-				   }  else if _,ok := v.(Nil); ok {
-				       //为空值
-				       ands = append(ands, fmt.Sprintf(`%s IS NULL`, k))
-				   } else if _,ok := v.(NotNil); ok {
-				       //不为空值
-				       ands = append(ands, fmt.Sprintf(`%s IS NOT NULL`, k))
-				   } else if fts,ok := v.(FTS); ok {
-				       //处理模糊搜索，此条后续版本会移除
-				       safeFts := strings.Replace(string(fts), "'", "''", -1)
-				       ands = append(ands, fmt.Sprintf(`%s LIKE '%%%s%%'`, k, safeFts))
-				*/
-			} else if ms, ok := v.([]Map); ok {
-				//是[]Map，相当于or
-
-				qs, vs, os := module.parsing(ms...)
-				if len(qs) > 0 {
-					ands = append(ands, fmt.Sprintf("(%s)", strings.Join(qs, " OR ")))
-					for _, vsVal := range vs {
-						values = append(values, vsVal)
+			realArgs := []string{}
+			if vvs, ok := opVal.([]Any); ok {
+				for _, vv := range vvs {
+					if vv == nil {
+						realArgs = append(realArgs, fmt.Sprintf(`%s is null`, k))
+					} else {
+						realArgs = append(realArgs, fmt.Sprintf(`%s=%s`, k, bind(vv)))
 					}
+
+				}
+			} else if vvs, ok := opVal.([]int64); ok {
+				for _, vv := range vvs {
+					realArgs = append(realArgs, fmt.Sprintf(`%s=%s`, k, bind(vv)))
+				}
+			} else if vvs, ok := opVal.([]float64); ok {
+				for _, vv := range vvs {
+					realArgs = append(realArgs, fmt.Sprintf(`%s=%s`, k, bind(vv)))
 				}
-				for _, osVal := range os {
-					orders = append(orders, osVal)
+			} else if vvs, ok := opVal.([]string); ok {
+				for _, vv := range vvs {
+					realArgs = append(realArgs, fmt.Sprintf(`%s=%s`, k, bind(vv)))
 				}
+			}
+
+			//和其它条件一起的时候要加括号
+			if len(realArgs) == 0 {
+				return ""
+			}
+			return fmt.Sprintf(`(%s)`, strings.Join(realArgs, " OR "))
 
-			} else if opMap, opOK := v.(Map); opOK {
-				//v要处理一下如果是map要特别处理
-				//key做为操作符，比如 > < >= 等
-				//而且多个条件是and，比如 views > 1 AND views < 100
-				//自定义操作符的时候，可以用  is not null 吗？
-				//hai yao chu li INC in change update
-
-				opAnds := []string{}
-				for opKey, opVal := range opMap {
-					//这里要支持LIKE
-					if opKey == SEARCH {
-						safeFts := strings.Replace(fmt.Sprintf("%v", opVal), "'", "''", -1)
-						opAnds = append(opAnds, fmt.Sprintf(`upper(%s) LIKE upper('%%%s%%')`, k, safeFts))
-					} else if opKey == FULLLIKE {
-						safeFts := strings.Replace(fmt.Sprintf("%v", opVal), "'", "''", -1)
-						opAnds = append(opAnds, fmt.Sprintf(`upper(%s) LIKE upper('%%%s%%')'`, k, safeFts))
-					} else if opKey == LEFTLIKE {
-						safeFts := strings.Replace(fmt.Sprintf("%v", opVal), "'", "''", -1)
-						opAnds = append(opAnds, fmt.Sprintf(`upper(%s) LIKE upper('%s%%')`, k, safeFts))
-					} else if opKey == RIGHTLIKE {
-						safeFts := strings.Replace(fmt.Sprintf("%v", opVal), "'", "''", -1)
-						opAnds = append(opAnds, fmt.Sprintf(`upper(%s) LIKE upper('%%%s')`, k, safeFts))
-					} else if opKey == ANY {
-						opAnds = append(opAnds, fmt.Sprintf(`? = ANY(%s)`, k))
-						values = append(values, opVal)
-						// } else if opKey == CON {
-						// 	opAnds = append(opAnds, fmt.Sprintf(`%s @> ?`, k))
-						// 	values = append(values, opVal)
-						// } else if opKey == CONBY {
-						// 	opAnds = append(opAnds, fmt.Sprintf(`%s <@ ?`, k))
-						// 	values = append(values, opVal)
-					} else if opKey == CON {
-						// array contains array @>
-
-						realArgs := []string{}
-						realVals := []Any{}
-						switch vs := opVal.(type) {
-						case []int:
-							if len(vs) > 0 {
-								for _, v := range vs {
-									realArgs = append(realArgs, "?::int8")
-									realVals = append(realVals, v)
-								}
-							} else {
-								realArgs = append(realArgs, "?")
-								realVals = append(realVals, 0)
-							}
-						case []int64:
-							if len(vs) > 0 {
-								for _, v := range vs {
-									realArgs = append(realArgs, "?::int8")
-									realVals = append(realVals, v)
-								}
-							} else {
-								realArgs = append(realArgs, "?")
-								realVals = append(realVals, 0)
-							}
-						case []string:
-							if len(vs) > 0 {
-								for _, v := range vs {
-									realArgs = append(realArgs, "?")
-									realVals = append(realVals, v)
-								}
-							} else {
-								realArgs = append(realArgs, "?")
-								realVals = append(realVals, 0)
-							}
-						case []Any:
-							if len(vs) > 0 {
-								for _, v := range vs {
-									realArgs = append(realArgs, "?")
-									realVals = append(realVals, v)
-								}
-							} else {
-								realArgs = append(realArgs, "?")
-								realVals = append(realVals, 0)
-							}
-						default:
-							realArgs = append(realArgs, "?")
-							realVals = append(realVals, vs)
-						}
-
-						opAnds = append(opAnds, fmt.Sprintf(`%s @> ARRAY[%s]`, k, strings.Join(realArgs, ",")))
-						for _, v := range realVals {
-							values = append(values, v)
-						}
-
-					} else if opKey == CONBY {
-						// array contains by array <@
-
-						realArgs := []string{}
-						realVals := []Any{}
-						switch vs := opVal.(type) {
-						case []int:
-							if len(vs) > 0 {
-								for _, v := range vs {
-									realArgs = append(realArgs, "?::int8")
-									realVals = append(realVals, v)
-								}
-							} else {
-								realArgs = append(realArgs, "?")
-								realVals = append(realVals, 0)
-							}
-						case []int64:
-							if len(vs) > 0 {
-								for _, v := range vs {
-									realArgs = append(realArgs, "?::int8")
-									realVals = append(realVals, v)
-								}
-							} else {
-								realArgs = append(realArgs, "?")
-								realVals = append(realVals, 0)
-							}
-						case []string:
-							if len(vs) > 0 {
-								for _, v := range vs {
-									realArgs = append(realArgs, "?")
-									realVals = append(realVals, v)
-								}
-							} else {
-								realArgs = append(realArgs, "?")
-								realVals = append(realVals, 0)
-							}
-						case []Any:
-							if len(vs) > 0 {
-								for _, v := range vs {
-									realArgs = append(realArgs, "?")
-									realVals = append(realVals, v)
-								}
-							} else {
-								realArgs = append(realArgs, "?")
-								realVals = append(realVals, 0)
-							}
-						default:
-							realArgs = append(realArgs, "?")
-							realVals = append(realVals, vs)
-						}
-
-						opAnds = append(opAnds, fmt.Sprintf(`%s <@ ARRAY[%s]`, k, strings.Join(realArgs, ",")))
-						for _, v := range realVals {
-							values = append(values, v)
-						}
-						opAnds = append(opAnds, fmt.Sprintf(`%s <@ '{}'`, k))
-
-					} else if opKey == OR {
-
-						realArgs := []string{}
-						realVals := []Any{}
-						if vvs, ok := opVal.([]Any); ok {
-							for _, vv := range vvs {
-								if vv == nil {
-									realArgs = append(realArgs, fmt.Sprintf(`%s is null`, k))
-								} else {
-									realArgs = append(realArgs, fmt.Sprintf(`%s=?`, k))
-									realVals = append(realVals, vv)
-								}
-
-							}
-						} else if vvs, ok := opVal.([]int64); ok {
-							for _, vv := range vvs {
-								realArgs = append(realArgs, fmt.Sprintf(`%s=?`, k))
-								realVals = append(realVals, vv)
-							}
-						} else if vvs, ok := opVal.([]float64); ok {
-							for _, vv := range vvs {
-								realArgs = append(realArgs, fmt.Sprintf(`%s=?`, k))
-								realVals = append(realVals, vv)
-							}
-						} else if vvs, ok := opVal.([]string); ok {
-							for _, vv := range vvs {
-								realArgs = append(realArgs, fmt.Sprintf(`%s=?`, k))
-								realVals = append(realVals, vv)
-							}
-						}
-
-						opAnds = append(opAnds, strings.Join(realArgs, " OR "))
-						for _, v := range realVals {
-							values = append(values, v)
-						}
-
-					} else if opKey == NOR {
-
-						realArgs := []string{}
-						realVals := []Any{}
-						incNull := true
-						if vvs, ok := opVal.([]Any); ok {
-							for _, vv := range vvs {
-								if vv == nil {
-									incNull = false
-								} else {
-									realArgs = append(realArgs, fmt.Sprintf(`%s=?`, k))
-									realVals = append(realVals, vv)
-								}
-							}
-						} else if vvs, ok := opVal.([]int64); ok {
-							for _, vv := range vvs {
-								realArgs = append(realArgs, fmt.Sprintf(`%s=?`, k))
-								realVals = append(realVals, vv)
-							}
-						} else if vvs, ok := opVal.([]float64); ok {
-							for _, vv := range vvs {
-								realArgs = append(realArgs, fmt.Sprintf(`%s==?`, k))
-								realVals = append(realVals, vv)
-							}
-						} else if vvs, ok := opVal.([]string); ok {
-							for _, vv := range vvs {
-								realArgs = append(realArgs, fmt.Sprintf(`%s==?`, k))
-								realVals = append(realVals, vv)
-							}
-						}
-
-						if incNull {
-							opAnds = append(opAnds, fmt.Sprintf(`NOT (%s) or %s is null`, strings.Join(realArgs, " OR "), k))
-						} else {
-							opAnds = append(opAnds, fmt.Sprintf(`NOT (%s)`, strings.Join(realArgs, " OR ")))
-						}
-
-						for _, v := range realVals {
-							values = append(values, v)
-						}
-
-					} else if opKey == IN {
-						//IN (?,?,?)
-
-						realArgs := []string{}
-						realVals := []Any{}
-						switch vs := opVal.(type) {
-						case []int:
-							if len(vs) > 0 {
-								for _, v := range vs {
-									realArgs = append(realArgs, "?")
-									realVals = append(realVals, v)
-								}
-							} else {
-								realArgs = append(realArgs, "?")
-								realVals = append(realVals, 0)
-							}
-						case []int64:
-							if len(vs) > 0 {
-								for _, v := range vs {
-									realArgs = append(realArgs, "?")
-									realVals = append(realVals, v)
-								}
-							} else {
-								realArgs = append(realArgs, "?")
-								realVals = append(realVals, 0)
-							}
-						case []string:
-							if len(vs) > 0 {
-								for _, v := range vs {
-									realArgs = append(realArgs, "?")
-									realVals = append(realVals, v)
-								}
-							} else {
-								realArgs = append(realArgs, "?")
-								realVals = append(realVals, 0)
-							}
-						case []Any:
-							if len(vs) > 0 {
-								for _, v := range vs {
-									realArgs = append(realArgs, "?")
-									realVals = append(realVals, v)
-								}
-							} else {
-								realArgs = append(realArgs, "?")
-								realVals = append(realVals, 0)
-							}
-						default:
-							realArgs = append(realArgs, "?")
-							realVals = append(realVals, vs)
-						}
-
-						opAnds = append(opAnds, fmt.Sprintf(`%s IN(%s)`, k, strings.Join(realArgs, ",")))
-						for _, v := range realVals {
-							values = append(values, v)
-						}
-
-					} else if opKey == NIN {
-						//NOT IN (?,?,?)
-
-						realArgs := []string{}
-						realVals := []Any{}
-						switch vs := opVal.(type) {
-						case []int:
-							if len(vs) > 0 {
-								for _, v := range vs {
-									realArgs = append(realArgs, "?")
-									realVals = append(realVals, v)
-								}
-							} else {
-								realArgs = append(realArgs, "?")
-								realVals = append(realVals, 0)
-							}
-						case []int64:
-							if len(vs) > 0 {
-								for _, v := range vs {
-									realArgs = append(realArgs, "?")
-									realVals = append(realVals, v)
-								}
-							} else {
-								realArgs = append(realArgs, "?")
-								realVals = append(realVals, 0)
-							}
-						case []string:
-							if len(vs) > 0 {
-								for _, v := range vs {
-									realArgs = append(realArgs, "?")
-									realVals = append(realVals, v)
-								}
-							} else {
-								realArgs = append(realArgs, "?")
-								realVals = append(realVals, 0)
-							}
-						case []Any:
-							if len(vs) > 0 {
-								for _, v := range vs {
-									realArgs = append(realArgs, "?")
-									realVals = append(realVals, v)
-								}
-							} else {
-								realArgs = append(realArgs, "?")
-								realVals = append(realVals, 0)
-							}
-						default:
-							realArgs = append(realArgs, "?")
-							realVals = append(realVals, vs)
-						}
-
-						opAnds = append(opAnds, fmt.Sprintf(`%s NOT IN(%s)`, k, strings.Join(realArgs, ",")))
-						for _, v := range realVals {
-							values = append(values, v)
-						}
+		} else if opKey == NOR {
 
+			realArgs := []string{}
+			incNull := true
+			if vvs, ok := opVal.([]Any); ok {
+				for _, vv := range vvs {
+					if vv == nil {
+						incNull = false
 					} else {
-						opAnds = append(opAnds, fmt.Sprintf(`%s %s ?`, k, opKey))
-						values = append(values, opVal)
+						realArgs = append(realArgs, fmt.Sprintf(`%s=%s`, k, bind(vv)))
 					}
 				}
+			} else if vvs, ok := opVal.([]int64); ok {
+				for _, vv := range vvs {
+					realArgs = append(realArgs, fmt.Sprintf(`%s=%s`, k, bind(vv)))
+				}
+			} else if vvs, ok := opVal.([]float64); ok {
+				for _, vv := range vvs {
+					realArgs = append(realArgs, fmt.Sprintf(`%s=%s`, k, bind(vv)))
+				}
+			} else if vvs, ok := opVal.([]string); ok {
+				for _, vv := range vvs {
+					realArgs = append(realArgs, fmt.Sprintf(`%s=%s`, k, bind(vv)))
+				}
+			}
+
+			if len(realArgs) == 0 {
+				return ""
+			}
+			if incNull {
+				return fmt.Sprintf(`(NOT (%s) or %s is null)`, strings.Join(realArgs, " OR "), k)
+			}
+			return fmt.Sprintf(`NOT (%s)`, strings.Join(realArgs, " OR "))
 
-				ands = append(ands, fmt.Sprintf("(%s)", strings.Join(opAnds, " AND ")))
+		} else if opKey == IN || opKey == NIN {
+			//IN (?,?,?)
+			//NOT IN (?,?,?)
 
-			} else {
-				ands = append(ands, fmt.Sprintf(`%s = ?`, k))
-				if jsoned {
-					values = append(values, fmt.Sprintf("%v", v))
-				} else {
-					values = append(values, v)
-				}
+			realArgs := []string{}
+			items, _ := this.arraying(opVal)
+			for _, item := range items {
+				realArgs = append(realArgs, bind(item))
 			}
+
+			if opKey == IN {
+				return fmt.Sprintf(`%s IN(%s)`, k, strings.Join(realArgs, ","))
+			}
+			return fmt.Sprintf(`%s NOT IN(%s)`, k, strings.Join(realArgs, ","))
 		}
 
-		if len(ands) > 0 {
-			querys = append(querys, fmt.Sprintf("(%s)", strings.Join(ands, " AND ")))
+		//注册的操作符
+		if operator, ok := module.operator(opKey); ok {
+			return operator.Render(dialect, k, opVal, bind)
 		}
+
+		return fmt.Sprintf(`%s %s %s`, k, opKey, bind(opVal))
 	}
 
-	return querys, values, orders
+	return ""
 }
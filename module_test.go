@@ -0,0 +1,70 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/chefsgo/base"
+	"github.com/chefsgo/chef"
+)
+
+func TestModuleDefault(t *testing.T) {
+	tests := []struct {
+		name      string
+		instances map[string]Instance
+		want      string
+	}{
+		{"chef default", map[string]Instance{
+			"a": {config: Config{Default: true}}, chef.DEFAULT: {},
+		}, chef.DEFAULT},
+		{"flag", map[string]Instance{
+			"a": {}, "b": {config: Config{Default: true}}, "c": {config: Config{Default: true}},
+		}, "b"},
+		{"first by name", map[string]Instance{"b": {}, "c": {}, "a": {}}, "a"},
+		{"none", map[string]Instance{}, chef.DEFAULT},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 10; i++ {
+			module := &Module{instances: test.instances}
+			if got := module.defaultName(); got != test.want {
+				t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestModuleGetBase(t *testing.T) {
+	memoryTesting(t)
+
+	if _, err := module.GetBase("test_module_unknown"); errors.Is(err, errInvalidDataConnection) == false {
+		t.Errorf("unknown: got %v, want errInvalidDataConnection", err)
+	}
+
+	base, err := module.GetBase()
+	if err != nil {
+		t.Fatalf("default: %v", err)
+	}
+	defer base.Close()
+	if name := base.(*moduleBase).name; name != "memory" {
+		t.Errorf("default: got %s, want memory", name)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("unknown Base should panic")
+		}
+	}()
+	module.Base("test_module_unknown")
+}
+
+func TestModuleConfigureDefault(t *testing.T) {
+	module := &Module{configs: map[string]Config{}}
+	module.configure("test_module_main", Map{"driver": "memory", "default": true})
+	module.configure("test_module_other", Map{"driver": "memory"})
+
+	if module.configs["test_module_main"].Default == false || module.configs["test_module_other"].Default {
+		t.Errorf("got %v", module.configs)
+	}
+}
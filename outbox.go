@@ -0,0 +1,171 @@
+package data
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/chefsgo/base"
+)
+
+// 事务性发件箱
+// 在 setting 里配置 outbox，触发器事件会先写入发件箱表，和数据在同一个事务中提交
+// 不在事务中的写入，会自动开启事务，发件箱写入失败的，数据写入也失败
+// 分发完成后再删除，进程在提交和分发之间崩溃的话，事件还在表里，可以用 Relay 重新投递
+// 发件箱表在 Connect 时创建，驱动不支持结构迁移的由驱动自己处理
+// outbox 可以是表名，或是 true 使用默认的 outbox 表
+// outbox_delay 为 Relay 跳过的最近时间，数字为秒，也可以是 "5m" 这样的字符串
+// 默认60秒，避免和正在分发的事件重复
+
+const (
+	defaultOutbox      = "outbox"
+	defaultOutboxDelay = 60
+)
+
+type (
+	// pendingEvent 等待分发的事件，id 为发件箱中的主键
+	pendingEvent struct {
+		event Event
+		id    Any
+	}
+)
+
+// outboxTable 发件箱表名，没有开启返回空
+func (this *Module) outboxTable(config Config) string {
+	switch vv := config.Setting["outbox"].(type) {
+	case string:
+		return vv
+	case bool:
+		if vv {
+			return defaultOutbox
+		}
+	}
+	return ""
+}
+
+// outboxConfig 发件箱表的定义，不注册到表里，避免和业务的表冲突
+func outboxConfig(name string) Table {
+	return Table{
+		Name: "发件箱", Table: name, Key: "id",
+		Fields: Vars{
+			"id":      Var{Type: "int"},
+			"name":    Var{Type: "string", Required: true},
+			"base":    Var{Type: "string"},
+			"table":   Var{Type: "string"},
+			"before":  Var{Type: "json"},
+			"after":   Var{Type: "json"},
+			"created": Var{Type: "datetime"},
+		},
+	}
+}
+
+// outboxing Connect 时创建发件箱表
+func (this *Module) outboxing(name string, config Config) error {
+	table := this.outboxTable(config)
+	if table == "" {
+		return nil
+	}
+
+	inst, err := this.instance(name)
+	if err != nil {
+		return err
+	}
+	base := inst.connect.Base()
+	defer base.Close()
+
+	return this.schemaCreating(base, table, outboxConfig(table))
+}
+
+// outbox 写入发件箱，返回主键，没有开启返回nil
+func (this *moduleBase) outbox(event Event) (Any, error) {
+	name := module.outboxTable(this.config)
+	if name == "" {
+		return nil, nil
+	}
+
+	item, err := this.base.Table(name).Checked().Create(Map{
+		"name": event.Name, "base": event.Base, "table": event.Table,
+		"before": event.Before, "after": event.After,
+		"created": time.Now(),
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+	return item["id"], nil
+}
+
+// delivered 分发完成，从发件箱删除
+func (this *moduleBase) delivered(id Any) {
+	name := module.outboxTable(this.config)
+	if name == "" || id == nil {
+		return
+	}
+	this.base.Table(name).Checked().Delete(Map{"id": id})
+}
+
+// Relay 重新投递发件箱中的事件
+// 只投递 outbox_delay 之前的事件，send 成功的从发件箱删除
+// 一般用于把事件转发到 chef 的事件总线，返回成功投递的数量
+func (this *Module) Relay(name string, send func(Event) error) (int64, error) {
+	inst, err := this.instance(name)
+	if err != nil {
+		return 0, err
+	}
+	table := this.outboxTable(inst.config)
+	if table == "" {
+		return 0, nil
+	}
+
+	delay := time.Second * defaultOutboxDelay
+	if vv, ok := settingDuration(inst.config.Setting, "outbox_delay", time.Second); ok {
+		delay = vv
+	}
+
+	base := inst.connect.Base()
+	defer base.Close()
+
+	before := time.Now().Add(-delay)
+	items, err := base.Table(table).Checked().Query(Map{"created": Map{"<": before}, "id": ASC})
+	if err != nil {
+		return 0, err
+	}
+
+	count := int64(0)
+	for _, item := range items {
+		event := Event{}
+		event.Name, _ = item["name"].(string)
+		event.Base, _ = item["base"].(string)
+		event.Table, _ = item["table"].(string)
+		event.Before = outboxMap(item["before"])
+		event.After = outboxMap(item["after"])
+
+		if err := send(event); err != nil {
+			return count, err
+		}
+
+		if _, err := base.Table(table).Checked().Delete(Map{"id": item["id"]}); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// outboxMap 还原事件数据，有的驱动读出来是json文本
+func outboxMap(value Any) Map {
+	switch vv := value.(type) {
+	case Map:
+		return vv
+	case string:
+		data := Map{}
+		if err := json.Unmarshal([]byte(vv), &data); err == nil {
+			return data
+		}
+	case []byte:
+		data := Map{}
+		if err := json.Unmarshal(vv, &data); err == nil {
+			return data
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/chefsgo/base"
+)
+
+func init() {
+	memoryConfigs["memory_outbox"] = Config{Driver: "memory", Setting: Map{"outbox": true}}
+	memoryConfigs["memory_outbox_fail"] = Config{Driver: "memory", Setting: Map{"outbox": "test_outbox_box"}}
+}
+
+func TestOutboxDelivery(t *testing.T) {
+	db := memoryTesting(t, "memory_outbox")
+	memorySeed(t, db, "test_outbox")
+	table := db.Table("test_outbox")
+
+	//分发的时候事件还在发件箱里，分发完才删除
+	boxed := []float64{}
+	recorder := triggerWatching("test_outbox_watch", "test_outbox", "", TriggerSync)
+	module.Watcher("test_outbox_count", Watcher{
+		Table: "test_outbox",
+		Action: func(Event) {
+			boxed = append(boxed, module.Base("memory_outbox").Table(defaultOutbox).Count())
+		},
+	}, true)
+
+	item := table.Create(Map{"name": "a"})
+	if err := db.Erred(); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if reflect.DeepEqual(boxed, []float64{1}) == false {
+		t.Errorf("boxed while delivering: got %v, want [1]", boxed)
+	}
+	if count := db.Table(defaultOutbox).Count(); count != 0 {
+		t.Errorf("outbox after delivery: got %v, want 0", count)
+	}
+
+	db.Begin()
+	table.Change(item, Map{"name": "b"})
+	if count := db.Table(defaultOutbox).Count(); count != 1 {
+		t.Errorf("outbox in transaction: got %v, want 1", count)
+	}
+	db.Cancel()
+	if count := db.Table(defaultOutbox).Count(); count != 0 {
+		t.Errorf("outbox after cancel: got %v, want 0", count)
+	}
+	if names := recorder.names(); reflect.DeepEqual(names, []string{CreateTrigger}) == false {
+		t.Errorf("events: got %v", names)
+	}
+}
+
+func TestOutboxFailure(t *testing.T) {
+	module.Table("test_outbox_box", Table{
+		Uniques: []Index{{Name: "test_outbox_box_table", Fields: []string{"table"}}},
+	}, true)
+	db := memoryTesting(t, "memory_outbox_fail")
+	memorySeed(t, db, "test_outbox_fail")
+	recorder := triggerWatching("test_outbox_fail_watch", "test_outbox_fail", "", TriggerSync)
+
+	//发件箱里已经有这个表的事件，再写入会违反唯一约束
+	if _, err := db.Table("test_outbox_box").Checked().Create(Map{"name": CreateTrigger, "table": "test_outbox_fail"}); err != nil {
+		t.Fatalf("seed outbox: %v", err)
+	}
+
+	_, err := db.Table("test_outbox_fail").Checked().Create(Map{"name": "a"})
+	if errors.Is(err, ErrDuplicate) == false {
+		t.Errorf("create: got %v, want ErrDuplicate", err)
+	}
+	if count := db.Table("test_outbox_fail").Count(); count != 0 {
+		t.Errorf("data count: got %v, want 0", count)
+	}
+	if names := recorder.names(); len(names) != 0 {
+		t.Errorf("events: got %v, want none", names)
+	}
+}
+
+func TestOutboxRelay(t *testing.T) {
+	db := memoryTesting(t, "memory_outbox")
+	memorySeed(t, db, defaultOutbox)
+
+	//崩溃留下的事件，以及刚写入可能还在分发的事件
+	box := db.Table(defaultOutbox).Checked()
+	box.Create(Map{
+		"name": ChangeTrigger, "base": "memory_outbox", "table": "test_outbox_relay",
+		"after": Map{"id": 1}, "created": time.Now().Add(-time.Hour),
+	})
+	box.Create(Map{
+		"name": ChangeTrigger, "base": "memory_outbox", "table": "test_outbox_relay",
+		"after": Map{"id": 2}, "created": time.Now(),
+	})
+
+	count, err := module.Relay("memory_outbox", func(Event) error {
+		return errors.New("bus down")
+	})
+	if err == nil || count != 0 {
+		t.Errorf("failed send: got %d %v", count, err)
+	}
+
+	events := []Event{}
+	count, err = module.Relay("memory_outbox", func(event Event) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil || count != 1 {
+		t.Fatalf("relay: got %d %v", count, err)
+	}
+	if events[0].Table != "test_outbox_relay" || reflect.DeepEqual(events[0].After, Map{"id": 1}) == false {
+		t.Errorf("relay event: got %v", events[0])
+	}
+	if count, _ := box.Count(); count != 1 {
+		t.Errorf("outbox after relay: got %v, want 1", count)
+	}
+}
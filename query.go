@@ -0,0 +1,383 @@
+package data
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	. "github.com/chefsgo/base"
+)
+
+const (
+	// LogicAnd, LogicOr 分组逻辑
+	LogicAnd = "AND"
+	LogicOr  = "OR"
+
+	// OpEqual 等于
+	OpEqual = "="
+	// OpNull 为空值
+	OpNull = "IS NULL"
+	// OpNotNull 不为空值
+	OpNotNull = "IS NOT NULL"
+
+	// OpLike, OpLeftLike, OpRightLike 包含，开头，结尾匹配，区分大小写
+	OpLike      = "$$like$$"
+	OpLeftLike  = "$$leftlikecase$$"
+	OpRightLike = "$$rightlikecase$$"
+	// OpILike, OpILeftLike, OpIRightLike 不区分大小写
+	// SEARCH 和 FULLLIKE 同 OpILike，LEFTLIKE 同 OpILeftLike，RIGHTLIKE 同 OpIRightLike
+	OpILike      = "$$ilike$$"
+	OpILeftLike  = "$$ileftlike$$"
+	OpIRightLike = "$$irightlike$$"
+
+	// LikeFull, LikeLeft, LikeRight 匹配方式
+	LikeFull  = "full"
+	LikeLeft  = "left"
+	LikeRight = "right"
+
+	// NullsFirst, NullsLast 空值排在前面或是后面
+	NullsFirst = "first"
+	NullsLast  = "last"
+)
+
+type (
+	// Query 查询语法树
+	// 由 Map 查询解析而来，驱动可以直接遍历，不需要再解析 Map
+	// 直接写sql的时候，只有 Raw, Args, RawOrder 有值
+	Query struct {
+		Raw      string
+		Args     []Any
+		RawOrder string
+
+		// Where 条件，为nil表示没有条件
+		Where *Group
+		// Sorts 排序，按出现的顺序
+		Sorts []Sort
+
+		// Offset, Limit 分页，由 ParsePage 设置，Limit 为0表示不分页
+		Offset int64
+		Limit  int64
+	}
+
+	// Node 条件节点，*Group 或是 *Condition
+	Node interface {
+		node()
+	}
+
+	// Group 逻辑分组，Logic 为 LogicAnd 或 LogicOr
+	Group struct {
+		Logic string
+		Nodes []Node
+	}
+
+	// Condition 单个条件
+	// Op 为 OpEqual, OpNull, OpNotNull，或是 IN, NIN, ANY, CON, CONBY, OR, NOR,
+	// SEARCH, FULLLIKE, LEFTLIKE, RIGHTLIKE, OpLike 这样的匹配，以及 > >= < <= != 这样的比较符
+	Condition struct {
+		Column
+		Op    string
+		Value Any
+	}
+
+	// Sort 排序
+	// Nulls 为 NullsFirst, NullsLast，为空时按数据库默认
+	// Collation 为排序规则，Cast 为 CastInt, CastFloat, CastText，json子字段按转换后的类型排序
+	// 转换成数字又没有指定 Nulls 的，空值当作0
+	Sort struct {
+		Column
+		Desc      bool
+		Random    bool
+		Nulls     string
+		Collation string
+		Cast      string
+	}
+
+	// Sorts 有序的排序，和 Map 一起做为查询参数，比如
+	// Sorts{Asc("name").Collate("NOCASE"), Desc("info.age").As(CastInt).NullsLast()}
+	// 按顺序排在 Map 里的 ASC, DESC 前面
+	Sorts []Sort
+
+	// Column 字段
+	// a.b 表示json字段a的子字段b，a:1 表示数组字段a的第1个元素
+	Column struct {
+		Key   string
+		Name  string
+		Json  string
+		Index int
+	}
+)
+
+func (this *Group) node()     {}
+func (this *Condition) node() {}
+
+// ParseColumn 解析字段
+func ParseColumn(key string) Column {
+	column := Column{Key: key, Name: key}
+	if dots := strings.Split(key, ":"); len(dots) >= 2 {
+		column.Name = dots[0]
+		fmt.Sscanf(dots[1], "%d", &column.Index)
+	} else if dots := strings.Split(key, "."); len(dots) >= 2 {
+		column.Name = dots[0]
+		column.Json = dots[1]
+	}
+	return column
+}
+
+// likeing 匹配的操作符，返回匹配方式和是否不区分大小写
+func likeing(op string) (string, bool, bool) {
+	switch op {
+	case OpLike:
+		return LikeFull, false, true
+	case OpLeftLike:
+		return LikeLeft, false, true
+	case OpRightLike:
+		return LikeRight, false, true
+	case OpILike, SEARCH, FULLLIKE:
+		return LikeFull, true, true
+	case OpILeftLike, LEFTLIKE:
+		return LikeLeft, true, true
+	case OpIRightLike, RIGHTLIKE:
+		return LikeRight, true, true
+	}
+	return "", false, false
+}
+
+// likePattern 转义 LIKE 的通配符，再按匹配方式加上%
+func likePattern(text, mode, escape string) string {
+	text = strings.NewReplacer(escape, escape+escape, "%", escape+"%", "_", escape+"_").Replace(text)
+	switch mode {
+	case LikeLeft:
+		return text + "%"
+	case LikeRight:
+		return "%" + text
+	}
+	return "%" + text + "%"
+}
+
+// Asc 升序
+func Asc(key string) Sort {
+	return Sort{Column: ParseColumn(key)}
+}
+
+// Desc 降序
+func Desc(key string) Sort {
+	return Sort{Column: ParseColumn(key), Desc: true}
+}
+
+// NullsFirst 空值排在前面
+func (this Sort) NullsFirst() Sort {
+	this.Nulls = NullsFirst
+	return this
+}
+
+// NullsLast 空值排在后面
+func (this Sort) NullsLast() Sort {
+	this.Nulls = NullsLast
+	return this
+}
+
+// Collate 排序规则
+func (this Sort) Collate(collation string) Sort {
+	this.Collation = collation
+	return this
+}
+
+// As 转换类型后排序
+func (this Sort) As(cast string) Sort {
+	this.Cast = cast
+	return this
+}
+
+// sorting 去掉参数里的排序，按顺序返回
+func sorting(args []Any) ([]Any, []Sort) {
+	sorts := []Sort{}
+	items := []Any{}
+	for _, arg := range args {
+		switch vv := arg.(type) {
+		case Sorts:
+			sorts = append(sorts, vv...)
+		case Sort:
+			sorts = append(sorts, vv)
+		default:
+			items = append(items, arg)
+		}
+	}
+	return items, sorts
+}
+
+// Paging 设置分页
+func (this *Query) Paging(offset, limit int64) *Query {
+	this.Offset = offset
+	this.Limit = limit
+	return this
+}
+
+// ParsePage 解析查询为语法树，并带上分页，驱动的 Limit 使用
+// offset 小于0的按0处理，limit 为0表示不分页
+func (this *Module) ParsePage(offset, limit Any, args ...Any) (*Query, error) {
+	query, err := this.ParseTree(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	start, count := int64(0), int64(0)
+	if vv, ok := validateCoerce("int", offset); ok && vv.(int64) > 0 {
+		start = vv.(int64)
+	}
+	if vv, ok := validateCoerce("int", limit); ok && vv.(int64) > 0 {
+		count = vv.(int64)
+	}
+	return query.Paging(start, count), nil
+}
+
+// ParseTree 解析查询为语法树
+// 参数和 Parse 一样，可以是sql加参数，或是多个Map，多个Map之间为或
+// 还可以有 Sorts 或 Sort 指定排序，直接写sql的，sql里没有 order by 才使用
+func (this *Module) ParseTree(args ...Any) (*Query, error) {
+	args, sorts := sorting(args)
+	query := &Query{Sorts: sorts}
+	if len(args) == 0 {
+		return query, nil
+	}
+
+	//如果直接写sql
+	if v, ok := args[0].(string); ok {
+		query.Raw = v
+		query.Args = []Any{}
+		for i, arg := range args {
+			if i > 0 {
+				query.Args = append(query.Args, arg)
+			}
+		}
+
+		//这里要处理一下，把order提取出来
+		//先拿到 order by 的位置
+		i := strings.Index(strings.ToLower(query.Raw), "order by")
+		if i >= 0 {
+			query.RawOrder = query.Raw[i:]
+			query.Raw = query.Raw[:i]
+		}
+
+		return query, nil
+	}
+
+	maps := []Map{}
+	for _, v := range args {
+		if m, ok := v.(Map); ok {
+			maps = append(maps, m)
+		}
+		//如果直接是[]Map，应该算OR处理啊，暂不处理这个
+	}
+
+	query.Where = this.treeing(query, maps...)
+	if query.Where != nil {
+		if err := queryChecking(query.Where); err != nil {
+			return nil, err
+		}
+	}
+	return query, nil
+}
+
+// queryChecking 检查条件，OR 和 NOR 的列表不能为空
+func queryChecking(node Node) error {
+	switch vv := node.(type) {
+	case *Group:
+		for _, child := range vv.Nodes {
+			if err := queryChecking(child); err != nil {
+				return err
+			}
+		}
+	case *Condition:
+		if vv.Op == OR || vv.Op == NOR {
+			value := reflect.ValueOf(vv.Value)
+			if vv.Value == nil || (value.Kind() == reflect.Slice && value.Len() == 0) {
+				return erroring(ErrInvalidQuery, fmt.Errorf("Empty list of %s", vv.Column.Key))
+			}
+		}
+	}
+	return nil
+}
+
+// treeing 实际的解析，支持递归，多个Map为或，单个Map内为与
+// 字段和操作符都按名称排序，同样的查询生成的SQL和参数顺序都是一样的
+// 没有条件的返回nil
+func (this *Module) treeing(query *Query, maps ...Map) *Group {
+	ors := &Group{Logic: LogicOr}
+
+	for _, m := range maps {
+		ands := &Group{Logic: LogicAnd}
+
+		for _, key := range queryKeys(m) {
+			v := m[key]
+			column := ParseColumn(key)
+
+			//如果值是ASC,DESC，表示是排序，json子字段按文本排序
+			if v == ASC {
+				query.Sorts = append(query.Sorts, Sort{Column: column})
+			} else if v == DESC {
+				query.Sorts = append(query.Sorts, Sort{Column: column, Desc: true})
+			} else if v == RAND {
+				query.Sorts = append(query.Sorts, Sort{Random: true})
+			} else if v == nil || v == NIL {
+				ands.Nodes = append(ands.Nodes, &Condition{Column: column, Op: OpNull})
+			} else if v == NOL {
+				ands.Nodes = append(ands.Nodes, &Condition{Column: column, Op: OpNotNull})
+			} else if ms, ok := v.([]Map); ok {
+				//是[]Map，相当于or
+				if group := this.treeing(query, ms...); group != nil {
+					ands.Nodes = append(ands.Nodes, group)
+				}
+			} else if opMap, ok := v.(Map); ok {
+				//key做为操作符，比如 > < >= 等
+				//而且多个条件是and，比如 views > 1 AND views < 100
+				opAnds := &Group{Logic: LogicAnd}
+				for _, opKey := range queryKeys(opMap) {
+					opAnds.Nodes = append(opAnds.Nodes, &Condition{Column: column, Op: opKey, Value: opMap[opKey]})
+				}
+				if len(opAnds.Nodes) > 0 {
+					ands.Nodes = append(ands.Nodes, opAnds)
+				}
+			} else {
+				ands.Nodes = append(ands.Nodes, &Condition{Column: column, Op: OpEqual, Value: v})
+			}
+		}
+
+		if len(ands.Nodes) > 0 {
+			ors.Nodes = append(ors.Nodes, ands)
+		}
+	}
+
+	if len(ors.Nodes) == 0 {
+		return nil
+	}
+	return ors
+}
+
+// Fingerprint 查询的指纹，参数和 Parse 一样
+// 同样的查询和参数得到同样的指纹，可以用来做缓存的键或是日志的比对
+func (this *Module) Fingerprint(args ...Any) (string, error) {
+	where, values, orderBy, err := this.Parse(args...)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha1.New()
+	fmt.Fprintf(hash, "%s\n%s\n", where, orderBy)
+	for _, value := range values {
+		fmt.Fprintf(hash, "%T:%v\n", value, value)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// queryKeys 排序后的键
+func queryKeys(m Map) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
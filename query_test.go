@@ -0,0 +1,271 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	. "github.com/chefsgo/base"
+)
+
+func TestParseDialects(t *testing.T) {
+	tests := []struct {
+		dialect string
+		args    []Any
+		where   string
+		values  []Any
+		order   string
+	}{
+		//比较，键按名称排序，同一个字段的操作符也排序
+		{"default", []Any{Map{"name": "a", "age": Map{GT: 1, LE: 9}}},
+			`(($age$ <= ? AND $age$ > ?) AND $name$ = ?)`, []Any{9, 1, "a"}, ``},
+		{"postgres", []Any{Map{"name": "a", "age": Map{GT: 1, LE: 9}}},
+			`(("age" <= $1 AND "age" > $2) AND "name" = $3)`, []Any{9, 1, "a"}, ``},
+		{"mysql", []Any{Map{"name": "a", "age": Map{GT: 1, LE: 9}}},
+			"((`age` <= ? AND `age` > ?) AND `name` = ?)", []Any{9, 1, "a"}, ``},
+		{"sqlite", []Any{Map{"name": "a", "age": Map{GT: 1, LE: 9}}},
+			`(("age" <= ? AND "age" > ?) AND "name" = ?)`, []Any{9, 1, "a"}, ``},
+
+		//json子字段，数组下标，数组包含
+		{"default", []Any{Map{"info.city": "bj", "tags:1": "x", "tags": Map{ANY: "y"}}},
+			`($info$->>'city' = ? AND (? = ANY($tags$)) AND $tags$[1] = ?)`, []Any{"bj", "y", "x"}, ``},
+		{"postgres", []Any{Map{"info.city": "bj", "tags:1": "x", "tags": Map{ANY: "y"}}},
+			`("info"->>'city' = $1 AND ($2 = ANY("tags")) AND "tags"[1] = $3)`, []Any{"bj", "y", "x"}, ``},
+		{"mysql", []Any{Map{"info.city": "bj", "tags:1": "x", "tags": Map{ANY: "y"}}},
+			"(JSON_UNQUOTE(JSON_EXTRACT(`info`, '$.city')) = ? AND (JSON_CONTAINS(`tags`, JSON_ARRAY(?))) AND JSON_EXTRACT(`tags`, '$[0]') = ?)", []Any{"bj", "y", "x"}, ``},
+		{"sqlite", []Any{Map{"info.city": "bj", "tags:1": "x", "tags": Map{ANY: "y"}}},
+			`(CAST(json_extract("info", '$.city') AS TEXT) = ? AND (? IN (SELECT value FROM json_each("tags"))) AND json_extract("tags", '$[0]') = ?)`, []Any{"bj", "y", "x"}, ``},
+
+		//整数数组
+		{"default", []Any{Map{"ids": Map{CON: []int64{1, 2}}}},
+			`(($ids$ @> ARRAY[?::int8,?::int8]))`, []Any{int64(1), int64(2)}, ``},
+		{"postgres", []Any{Map{"ids": Map{CON: []int64{1, 2}}}},
+			`(("ids" @> ARRAY[($1)::int8,($2)::int8]))`, []Any{int64(1), int64(2)}, ``},
+		{"mysql", []Any{Map{"ids": Map{CON: []int64{1, 2}}}},
+			"((JSON_CONTAINS(`ids`, JSON_ARRAY(CAST(? AS SIGNED),CAST(? AS SIGNED)))))", []Any{int64(1), int64(2)}, ``},
+		{"sqlite", []Any{Map{"ids": Map{CON: []int64{1, 2}}}},
+			`(((CAST(? AS INTEGER) IN (SELECT value FROM json_each("ids")) AND CAST(? AS INTEGER) IN (SELECT value FROM json_each("ids")))))`, []Any{int64(1), int64(2)}, ``},
+	}
+
+	for _, test := range tests {
+		where, values, order, err := module.ParseWith(module.DialectConfig(test.dialect), test.args...)
+		if err != nil {
+			t.Errorf("%s %v: %v", test.dialect, test.args, err)
+			continue
+		}
+		if where != test.where {
+			t.Errorf("%s where:\n got %s\nwant %s", test.dialect, where, test.where)
+		}
+		if reflect.DeepEqual(values, test.values) == false {
+			t.Errorf("%s values: got %#v, want %#v", test.dialect, values, test.values)
+		}
+		if order != test.order {
+			t.Errorf("%s order:\n got %s\nwant %s", test.dialect, order, test.order)
+		}
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	query, err := module.ParsePage(10, 5, Map{"name": "a", "age": Map{GT: 1}}, Map{"name": "b"}, Sorts{Desc("age")})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	where := &Group{Logic: LogicOr, Nodes: []Node{
+		&Group{Logic: LogicAnd, Nodes: []Node{
+			&Group{Logic: LogicAnd, Nodes: []Node{
+				&Condition{Column: ParseColumn("age"), Op: GT, Value: 1},
+			}},
+			&Condition{Column: ParseColumn("name"), Op: OpEqual, Value: "a"},
+		}},
+		&Group{Logic: LogicAnd, Nodes: []Node{
+			&Condition{Column: ParseColumn("name"), Op: OpEqual, Value: "b"},
+		}},
+	}}
+	if reflect.DeepEqual(query.Where, where) == false {
+		t.Errorf("where: got %#v", query.Where)
+	}
+	if reflect.DeepEqual(query.Sorts, []Sort{Desc("age")}) == false {
+		t.Errorf("sorts: got %#v", query.Sorts)
+	}
+	if query.Offset != 10 || query.Limit != 5 {
+		t.Errorf("paging: got %d %d, want 10 5", query.Offset, query.Limit)
+	}
+
+	raw, err := module.ParseTree("name=? ORDER BY id", "a")
+	if err != nil {
+		t.Fatalf("parse raw: %v", err)
+	}
+	if raw.Raw != "name=? " || raw.RawOrder != "ORDER BY id" || reflect.DeepEqual(raw.Args, []Any{"a"}) == false {
+		t.Errorf("raw: got %#v", raw)
+	}
+}
+
+func TestParseOrNor(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []Any
+		where  string
+		values []Any
+	}{
+		{"or", []Any{Map{"age": Map{OR: []Any{1, nil}}, "name": "x"}},
+			`((($age$=? OR $age$ is null)) AND $name$ = ?)`, []Any{1, "x"}},
+		{"nor", []Any{Map{"age": Map{NOR: []Any{1, 2}}, "name": "x"}},
+			`(((NOT ($age$=? OR $age$=?) or $age$ is null)) AND $name$ = ?)`, []Any{1, 2, "x"}},
+		{"nor nil", []Any{Map{"age": Map{NOR: []Any{1, nil}}, "name": "x"}},
+			`((NOT ($age$=?)) AND $name$ = ?)`, []Any{1, "x"}},
+	}
+	for _, test := range tests {
+		where, values, _, err := module.Parse(test.args...)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if where != test.where {
+			t.Errorf("%s where:\n got %s\nwant %s", test.name, where, test.where)
+		}
+		if reflect.DeepEqual(values, test.values) == false {
+			t.Errorf("%s values: got %#v, want %#v", test.name, values, test.values)
+		}
+	}
+
+	for _, op := range []string{OR, NOR} {
+		if _, _, _, err := module.Parse(Map{"age": Map{op: []Any{}}}); errors.Is(err, ErrInvalidQuery) == false {
+			t.Errorf("empty %s: got %v, want ErrInvalidQuery", op, err)
+		}
+	}
+}
+
+func TestParseLike(t *testing.T) {
+	args := []Any{Map{"name": Map{SEARCH: `50%_off\!`}}, Map{"name": Map{OpLeftLike: "a_b"}}}
+
+	tests := []struct {
+		dialect string
+		where   string
+		values  []Any
+	}{
+		{"default", `((upper($name$) LIKE upper(?) ESCAPE '!')) OR (($name$ LIKE ? ESCAPE '!'))`,
+			[]Any{`%50!%!_off\!!%`, `a!_b%`}},
+		{"postgres", `(("name" ILIKE $1 ESCAPE '\')) OR (("name" LIKE $2 ESCAPE '\'))`,
+			[]Any{`%50\%\_off\\!%`, `a\_b%`}},
+		{"mysql", "((LOWER(`name`) LIKE LOWER(?) ESCAPE '!')) OR ((CAST(`name` AS BINARY) LIKE ? ESCAPE '!'))",
+			[]Any{`%50!%!_off\!!%`, `a!_b%`}},
+		{"sqlite", `(("name" LIKE ? ESCAPE '\')) OR (("name" GLOB ?))`,
+			[]Any{`%50\%\_off\\!%`, `a_b*`}},
+	}
+
+	for _, test := range tests {
+		where, values, _, err := module.ParseWith(module.DialectConfig(test.dialect), args...)
+		if err != nil {
+			t.Errorf("%s: %v", test.dialect, err)
+			continue
+		}
+		if where != test.where {
+			t.Errorf("%s where:\n got %s\nwant %s", test.dialect, where, test.where)
+		}
+		if reflect.DeepEqual(values, test.values) == false {
+			t.Errorf("%s values: got %#v, want %#v", test.dialect, values, test.values)
+		}
+	}
+}
+
+func TestParseJsonKey(t *testing.T) {
+	args := []Any{Map{"info.a'b": 1}}
+
+	tests := []struct {
+		dialect string
+		where   string
+	}{
+		{"default", `($info$->>'a''b' = ?)`},
+		{"postgres", `("info"->>'a''b' = $1)`},
+		{"mysql", "(JSON_UNQUOTE(JSON_EXTRACT(`info`, '$.a''b')) = ?)"},
+		{"sqlite", `(CAST(json_extract("info", '$.a''b') AS TEXT) = ?)`},
+	}
+
+	for _, test := range tests {
+		where, _, _, err := module.ParseWith(module.DialectConfig(test.dialect), args...)
+		if err != nil {
+			t.Errorf("%s: %v", test.dialect, err)
+			continue
+		}
+		if where != test.where {
+			t.Errorf("%s where:\n got %s\nwant %s", test.dialect, where, test.where)
+		}
+	}
+}
+
+func TestParseDeterministic(t *testing.T) {
+	args := []Any{Map{"e": 5, "d": 4, "c": Map{GT: 3, LT: 30, NE: 13}, "b": 2, "a": 1}}
+
+	where, values, _, _ := module.Parse(args...)
+	fingerprint, _ := module.Fingerprint(args...)
+	for i := 0; i < 50; i++ {
+		w, v, _, _ := module.Parse(args...)
+		if w != where || reflect.DeepEqual(v, values) == false {
+			t.Fatalf("parse changed: %s %v, first %s %v", w, v, where, values)
+		}
+		if f, _ := module.Fingerprint(args...); f != fingerprint {
+			t.Fatalf("fingerprint changed: %s, first %s", f, fingerprint)
+		}
+	}
+
+	tests := []struct {
+		name string
+		args []Any
+		same bool
+	}{
+		{"same", []Any{Map{"a": 1, "b": 2, "c": Map{NE: 13, LT: 30, GT: 3}, "d": 4, "e": 5}}, true},
+		{"value", []Any{Map{"e": 5, "d": 4, "c": Map{GT: 3, LT: 30, NE: 13}, "b": 2, "a": 2}}, false},
+		{"type", []Any{Map{"e": 5, "d": 4, "c": Map{GT: 3, LT: 30, NE: 13}, "b": 2, "a": "1"}}, false},
+		{"order", []Any{Map{"e": 5, "d": 4, "c": Map{GT: 3, LT: 30, NE: 13}, "b": 2, "a": 1}, Sorts{Asc("a")}}, false},
+	}
+	for _, test := range tests {
+		f, err := module.Fingerprint(test.args...)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if (f == fingerprint) != test.same {
+			t.Errorf("%s: same fingerprint should be %v", test.name, test.same)
+		}
+	}
+}
+
+func TestParseSorts(t *testing.T) {
+	tests := []struct {
+		dialect string
+		args    []Any
+		order   string
+	}{
+		//Sorts 排在 Map 里的排序前面
+		{"default", []Any{Map{"a": 1, "b": DESC}, Sorts{Asc("name").Collate("NOCASE").NullsLast(), Desc("info.age").As(CastInt)}},
+			`ORDER BY $name$ COLLATE "NOCASE" ASC NULLS LAST,COALESCE(($info$->>'age')::int8, 0) DESC,$b$ DESC`},
+		{"postgres", []Any{Map{"a": 1, "b": DESC}, Sorts{Asc("name").Collate("NOCASE").NullsLast(), Desc("info.age").As(CastInt)}},
+			`ORDER BY "name" COLLATE "NOCASE" ASC NULLS LAST,COALESCE(("info"->>'age')::int8, 0) DESC,"b" DESC`},
+		{"mysql", []Any{Map{"a": 1, "b": DESC}, Sorts{Asc("name").Collate("NOCASE").NullsLast(), Desc("info.age").As(CastInt)}},
+			"ORDER BY `name` COLLATE `NOCASE` IS NULL ASC,`name` COLLATE `NOCASE` ASC,COALESCE(CAST(JSON_UNQUOTE(JSON_EXTRACT(`info`, '$.age')) AS SIGNED), 0) DESC,`b` DESC"},
+		{"sqlite", []Any{Map{"a": 1, "b": DESC}, Sorts{Asc("name").Collate("NOCASE").NullsLast(), Desc("info.age").As(CastInt)}},
+			`ORDER BY "name" COLLATE "NOCASE" ASC NULLS LAST,COALESCE(CAST(CAST(json_extract("info", '$.age') AS TEXT) AS INTEGER), 0) DESC,"b" DESC`},
+
+		//指定了空值顺序的不用 COALESCE
+		{"default", []Any{Sorts{Asc("rank").As(CastFloat).NullsFirst()}},
+			`ORDER BY ($rank$)::float8 ASC NULLS FIRST`},
+		{"postgres", []Any{Sorts{Asc("rank").As(CastFloat).NullsFirst()}},
+			`ORDER BY ("rank")::float8 ASC NULLS FIRST`},
+		{"mysql", []Any{Sorts{Asc("rank").As(CastFloat).NullsFirst()}},
+			"ORDER BY CAST(`rank` AS DOUBLE) IS NULL DESC,CAST(`rank` AS DOUBLE) ASC"},
+		{"sqlite", []Any{Sorts{Asc("rank").As(CastFloat).NullsFirst()}},
+			`ORDER BY CAST("rank" AS REAL) ASC NULLS FIRST`},
+	}
+
+	for _, test := range tests {
+		_, _, order, err := module.ParseWith(module.DialectConfig(test.dialect), test.args...)
+		if err != nil {
+			t.Errorf("%s: %v", test.dialect, err)
+			continue
+		}
+		if order != test.order {
+			t.Errorf("%s order:\n got %s\nwant %s", test.dialect, order, test.order)
+		}
+	}
+}
@@ -0,0 +1,468 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	. "github.com/chefsgo/base"
+)
+
+// 关联
+// 在 Table.Relates 里定义，查询时加上 Include("org", "orders.items") 预加载
+// 每个关联只额外查询一次，用 IN 批量拿到所有的关联数据，再放到结果里
+// belongs 放的是 Map，没有的为nil，many 和 manymany 放的是 []Map
+// Remove 时按 Status 级联删除或是阻止删除，在一个事务里完成
+// 关联的定义在注册表的时候检查，不对的直接 panic
+// 模型的字段也可以引用表或视图，查询时同样每个字段只批量查询一次
+
+const (
+	// RelateBelongs 属于
+	RelateBelongs = "belongs"
+	// RelateMany 一对多
+	RelateMany = "many"
+	// RelateManyMany 多对多
+	RelateManyMany = "manymany"
+
+	// RelateCascade 级联删除
+	RelateCascade = "cascade"
+	// RelateRestrict 有关联数据时不能删除
+	RelateRestrict = "restrict"
+)
+
+type (
+	includeScope []string
+)
+
+// Include 预加载关联，用.分隔加载关联的关联
+func Include(names ...string) Any {
+	return includeScope(names)
+}
+
+// includeScoping 去掉 Include，返回要加载的关联
+func includeScoping(args []Any) ([]Any, []string) {
+	includes := []string{}
+	items := []Any{}
+	for _, arg := range args {
+		if vv, ok := arg.(includeScope); ok {
+			includes = append(includes, vv...)
+		} else {
+			items = append(items, arg)
+		}
+	}
+	return items, includes
+}
+
+// relateChecking 检查表的关联定义
+// belongs 要有 Field，many 要有 Key，manymany 要有 Through, Field, Key
+func relateChecking(name string, config Table) error {
+	for key, relate := range config.Relates {
+		invalid := func(reason string) error {
+			return fmt.Errorf("Invalid data relation %s of %s: %s", key, name, reason)
+		}
+		if relate.Table == "" {
+			return invalid("table is required")
+		}
+		switch relate.Type {
+		case RelateBelongs:
+			if relate.Field == "" {
+				return invalid("field is required for belongs")
+			}
+		case RelateMany:
+			if relate.Key == "" {
+				return invalid("key is required for many")
+			}
+		case RelateManyMany:
+			if relate.Through == "" || relate.Field == "" || relate.Key == "" {
+				return invalid("through, field and key are required for manymany")
+			}
+		default:
+			return invalid("unknown type " + relate.Type)
+		}
+		if relate.Status != "" && relate.Status != RelateCascade && relate.Status != RelateRestrict {
+			return invalid("unknown status " + relate.Status)
+		}
+	}
+	return nil
+}
+
+// tableKey 表的主键
+func (this *Module) tableKey(name string) string {
+	if config, ok := this.tables[name]; ok && config.Key != "" {
+		return config.Key
+	}
+	return "id"
+}
+
+// preloading 加载关联数据，放到 items 里
+func (this *Module) preloading(base *moduleBase, name string, items []Map, includes []string) error {
+	if len(items) == 0 || len(includes) == 0 {
+		return nil
+	}
+
+	//按第一级分组，后面的交给关联表继续加载
+	names := []string{}
+	nested := map[string][]string{}
+	for _, include := range includes {
+		parts := strings.SplitN(include, ".", 2)
+		if _, ok := nested[parts[0]]; ok == false {
+			names = append(names, parts[0])
+			nested[parts[0]] = []string{}
+		}
+		if len(parts) > 1 {
+			nested[parts[0]] = append(nested[parts[0]], parts[1])
+		}
+	}
+
+	config := this.tables[name]
+	for _, key := range names {
+		relate, ok := config.Relates[key]
+		if ok == false {
+			return erroring(ErrInvalidQuery, fmt.Errorf("Invalid relation %s of %s", key, name))
+		}
+
+		var err error
+		switch relate.Type {
+		case RelateBelongs:
+			err = this.belonging(base, key, relate, items, nested[key])
+		case RelateMany:
+			err = this.having(base, name, key, relate, items, nested[key])
+		case RelateManyMany:
+			err = this.throughing(base, name, key, relate, items, nested[key])
+		default:
+			err = erroring(ErrInvalidQuery, fmt.Errorf("Invalid relation type %s of %s", relate.Type, name))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// belonging 属于，item[Field] = 关联表[Key]
+func (this *Module) belonging(base *moduleBase, name string, relate Relate, items []Map, includes []string) error {
+	remote := relate.Key
+	if remote == "" {
+		remote = this.tableKey(relate.Table)
+	}
+
+	rows, err := this.relating(base, relate.Table, remote, relateValues(items, relate.Field), includes)
+	if err != nil {
+		return err
+	}
+	index := map[string]Map{}
+	for _, row := range rows {
+		index[relateKey(row[remote])] = row
+	}
+
+	for _, item := range items {
+		if row, ok := index[relateKey(item[relate.Field])]; ok && item[relate.Field] != nil {
+			item[name] = relateCopy(row)
+		} else {
+			item[name] = nil
+		}
+	}
+	return nil
+}
+
+// having 一对多，关联表[Key] = item[Field]
+func (this *Module) having(base *moduleBase, table, name string, relate Relate, items []Map, includes []string) error {
+	local := relate.Field
+	if local == "" {
+		local = this.tableKey(table)
+	}
+
+	rows, err := this.relating(base, relate.Table, relate.Key, relateValues(items, local), includes)
+	if err != nil {
+		return err
+	}
+	groups := map[string][]Map{}
+	for _, row := range rows {
+		id := relateKey(row[relate.Key])
+		groups[id] = append(groups[id], row)
+	}
+
+	for _, item := range items {
+		if rows, ok := groups[relateKey(item[local])]; ok && item[local] != nil {
+			item[name] = rows
+		} else {
+			item[name] = []Map{}
+		}
+	}
+	return nil
+}
+
+// throughing 多对多，先查中间表，再查关联表
+func (this *Module) throughing(base *moduleBase, table, name string, relate Relate, items []Map, includes []string) error {
+	local := this.tableKey(table)
+	remote := this.tableKey(relate.Table)
+
+	joins, err := this.relating(base, relate.Through, relate.Field, relateValues(items, local), nil)
+	if err != nil {
+		return err
+	}
+	rows, err := this.relating(base, relate.Table, remote, relateValues(joins, relate.Key), includes)
+	if err != nil {
+		return err
+	}
+
+	index := map[string]Map{}
+	for _, row := range rows {
+		index[relateKey(row[remote])] = row
+	}
+	groups := map[string][]Map{}
+	for _, join := range joins {
+		if row, ok := index[relateKey(join[relate.Key])]; ok {
+			id := relateKey(join[relate.Field])
+			groups[id] = append(groups[id], relateCopy(row))
+		}
+	}
+
+	for _, item := range items {
+		if rows, ok := groups[relateKey(item[local])]; ok {
+			item[name] = rows
+		} else {
+			item[name] = []Map{}
+		}
+	}
+	return nil
+}
+
+// relating 批量查询关联表，没有值的不查询
+func (this *Module) relating(base *moduleBase, table, field string, values []Any, includes []string) ([]Map, error) {
+	if len(values) == 0 {
+		return []Map{}, nil
+	}
+	args := []Any{Map{field: Map{IN: values}}}
+	if len(includes) > 0 {
+		args = append(args, Include(includes...))
+	}
+	return base.Table(table).Checked().Query(args...)
+}
+
+// referencing 模型字段引用的表或视图
+// 字段的 Setting 里 table 或 view 为引用的表或视图，key 为引用的字段，field 为模型的字段
+// 数组类型的字段放 []Map，key 必须指定，field 默认为模型的主键
+// 其它类型的字段放 Map，没有的为nil，field 必须指定，key 默认为引用的主键
+// 引用表的时候可以用 Setting 里的 include 继续预加载表的关联
+func (this *Module) referencing(base *moduleBase, name string, items []Map) error {
+	config, ok := this.models[name]
+	if ok == false || len(items) == 0 {
+		return nil
+	}
+
+	keys := []string{}
+	for key, field := range config.Fields {
+		if field.Setting["table"] != nil || field.Setting["view"] != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field := config.Fields[key]
+		table, _ := field.Setting["table"].(string)
+		view, _ := field.Setting["view"].(string)
+		remote, _ := field.Setting["key"].(string)
+		local, _ := field.Setting["field"].(string)
+		many := strings.HasPrefix(field.Type, "[")
+
+		if many && local == "" {
+			local = config.Key
+			if local == "" {
+				local = "id"
+			}
+		}
+		if many == false && remote == "" {
+			if table != "" {
+				remote = this.tableKey(table)
+			} else if vv, ok := this.views[view]; ok && vv.Key != "" {
+				remote = vv.Key
+			} else {
+				remote = "id"
+			}
+		}
+		if (table == "" && view == "") || remote == "" || local == "" {
+			return erroring(ErrInvalidQuery, fmt.Errorf("Invalid reference %s of %s", key, name))
+		}
+
+		values := relateValues(items, local)
+		rows := []Map{}
+		if len(values) > 0 {
+			var err error
+			args := []Any{Map{remote: Map{IN: values}}}
+			if table != "" {
+				if includes, ok := field.Setting["include"].([]string); ok && len(includes) > 0 {
+					args = append(args, Include(includes...))
+				}
+				rows, err = base.Table(table).Checked().Query(args...)
+			} else {
+				rows, err = base.View(view).Checked().Query(args...)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		groups := map[string][]Map{}
+		for _, row := range rows {
+			id := relateKey(row[remote])
+			groups[id] = append(groups[id], row)
+		}
+		//多个数据引用到同一行的，每个拿到自己的一份
+		for _, item := range items {
+			group, ok := groups[relateKey(item[local])]
+			if item[local] == nil {
+				ok = false
+			}
+			if many {
+				copies := []Map{}
+				if ok {
+					for _, row := range group {
+						copies = append(copies, relateCopy(row))
+					}
+				}
+				item[key] = copies
+			} else if ok {
+				item[key] = relateCopy(group[0])
+			} else {
+				item[key] = nil
+			}
+		}
+	}
+	return nil
+}
+
+// removing 删除前按关联的 Status 检查或是级联删除
+func (this *Module) removing(base *moduleBase, name string, item Map) error {
+	config := this.tables[name]
+
+	keys := []string{}
+	for key, relate := range config.Relates {
+		if relate.Status != "" && relate.Type != RelateBelongs {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		relate := config.Relates[key]
+
+		table, field, value := relate.Table, relate.Key, item[relate.Field]
+		if relate.Type == RelateManyMany {
+			table, field, value = relate.Through, relate.Field, item[this.tableKey(name)]
+		} else if relate.Field == "" {
+			value = item[this.tableKey(name)]
+		}
+		if value == nil {
+			continue
+		}
+
+		related := base.Table(table).Checked()
+		switch relate.Status {
+		case RelateRestrict:
+			count, err := related.Count(Map{field: value})
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return erroring(ErrConstraint, fmt.Errorf("Data %s has related %s", name, key))
+			}
+
+		case RelateCascade:
+			if relate.Type == RelateManyMany {
+				//多对多只删除中间表
+				if _, err := related.Delete(Map{field: value}); err != nil {
+					return err
+				}
+				continue
+			}
+			//一个一个删除，关联表的关联和触发器都会处理
+			rows, err := related.Query(Map{field: value})
+			if err != nil {
+				return err
+			}
+			relatedKey := this.tableKey(table)
+			for _, row := range rows {
+				if _, err := related.Remove(Map{relatedKey: row[relatedKey]}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// cascading 表是否有需要在删除时处理的关联
+func (this *Module) cascading(name string) bool {
+	for _, relate := range this.tables[name].Relates {
+		if relate.Status != "" && relate.Type != RelateBelongs {
+			return true
+		}
+	}
+	return false
+}
+
+// relateValues 去重后的字段值
+func relateValues(items []Map, field string) []Any {
+	values := []Any{}
+	seen := map[string]bool{}
+	for _, item := range items {
+		value := item[field]
+		if value == nil {
+			continue
+		}
+		key := relateKey(value)
+		if seen[key] == false {
+			seen[key] = true
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// relateCopy 复制关联数据，多个数据关联到同一行的，每个拿到自己的一份
+// 嵌套加载的关联也一起复制
+func relateCopy(row Map) Map {
+	item := Map{}
+	for key, value := range row {
+		switch vv := value.(type) {
+		case Map:
+			item[key] = relateCopy(vv)
+		case []Map:
+			rows := make([]Map, len(vv))
+			for i, row := range vv {
+				rows[i] = relateCopy(row)
+			}
+			item[key] = rows
+		default:
+			item[key] = value
+		}
+	}
+	return item
+}
+
+// relateKey 关联匹配用的值，整数统一类型，int64 和 float64 也能匹配上
+func relateKey(value Any) string {
+	switch vv := value.(type) {
+	case int:
+		return fmt.Sprintf("%d", vv)
+	case int32:
+		return fmt.Sprintf("%d", vv)
+	case int64:
+		return fmt.Sprintf("%d", vv)
+	case uint:
+		return fmt.Sprintf("%d", vv)
+	case uint32:
+		return fmt.Sprintf("%d", vv)
+	case uint64:
+		return fmt.Sprintf("%d", vv)
+	case float32:
+		return relateKey(float64(vv))
+	case float64:
+		if vv == float64(int64(vv)) {
+			return fmt.Sprintf("%d", int64(vv))
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,153 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	. "github.com/chefsgo/base"
+)
+
+// relationTesting 注册测试用的表，组织有用户，用户有文章和标签
+func relationTesting(t *testing.T) DataBase {
+	module.Table("test_rel_org", Table{Relates: map[string]Relate{
+		"users": {Type: RelateMany, Table: "test_rel_user", Key: "org_id", Status: RelateRestrict},
+	}}, true)
+	module.Table("test_rel_user", Table{Relates: map[string]Relate{
+		"org":   {Type: RelateBelongs, Table: "test_rel_org", Field: "org_id"},
+		"posts": {Type: RelateMany, Table: "test_rel_post", Key: "user_id", Status: RelateCascade},
+		"tags":  {Type: RelateManyMany, Table: "test_rel_tag", Through: "test_rel_user_tag", Field: "user_id", Key: "tag_id", Status: RelateCascade},
+	}}, true)
+
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_rel_org", Map{"name": "one"}, Map{"name": "two"})
+	memorySeed(t, db, "test_rel_user",
+		Map{"name": "a", "org_id": 1}, Map{"name": "b", "org_id": 1}, Map{"name": "c"},
+	)
+	memorySeed(t, db, "test_rel_post",
+		Map{"title": "a1", "user_id": 1}, Map{"title": "a2", "user_id": 1}, Map{"title": "b1", "user_id": 2},
+	)
+	memorySeed(t, db, "test_rel_tag", Map{"name": "x"}, Map{"name": "y"})
+	memorySeed(t, db, "test_rel_user_tag",
+		Map{"user_id": 1, "tag_id": 1}, Map{"user_id": 1, "tag_id": 2}, Map{"user_id": 2, "tag_id": 1},
+	)
+	return db
+}
+
+func TestRelationInclude(t *testing.T) {
+	db := relationTesting(t)
+
+	users, err := db.Table("test_rel_user").Checked().Query(Map{"id": ASC}, Include("org", "posts", "tags"))
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+
+	tests := []struct {
+		org   Any
+		posts []string
+		tags  []string
+	}{
+		{"one", []string{"1", "2"}, []string{"1", "2"}},
+		{"one", []string{"3"}, []string{"1"}},
+		{nil, []string{}, []string{}},
+	}
+	for i, test := range tests {
+		user := users[i]
+		var org Any
+		if vv, ok := user["org"].(Map); ok {
+			org = vv["name"]
+		}
+		if org != test.org {
+			t.Errorf("user %d org: got %v, want %v", i+1, user["org"], test.org)
+		}
+		if ids := memoryIds(user["posts"].([]Map)); reflect.DeepEqual(ids, test.posts) == false {
+			t.Errorf("user %d posts: got %v, want %v", i+1, ids, test.posts)
+		}
+		if ids := memoryIds(user["tags"].([]Map)); reflect.DeepEqual(ids, test.tags) == false {
+			t.Errorf("user %d tags: got %v, want %v", i+1, ids, test.tags)
+		}
+	}
+
+	//关联到同一行的，每个拿到自己的一份
+	users[0]["org"].(Map)["name"] = "changed"
+	users[0]["tags"].([]Map)[0]["name"] = "changed"
+	if users[1]["org"].(Map)["name"] != "one" || users[1]["tags"].([]Map)[0]["name"] != "x" {
+		t.Errorf("related rows are shared: got %v %v", users[1]["org"], users[1]["tags"])
+	}
+
+	org, err := db.Table("test_rel_org").Checked().First(Map{"id": 1}, Include("users.posts"))
+	if err != nil {
+		t.Fatalf("nested: %v", err)
+	}
+	if users := org["users"].([]Map); len(users) != 2 || len(users[0]["posts"].([]Map)) != 2 {
+		t.Errorf("nested: got %v", org["users"])
+	}
+
+	if _, err := db.Table("test_rel_user").Checked().Query(Include("none")); errors.Is(err, ErrInvalidQuery) == false {
+		t.Errorf("unknown relation: got %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestRelationRemove(t *testing.T) {
+	db := relationTesting(t)
+	removed := triggerWatching("test_rel_post_removed", "test_rel_post", RemoveTrigger, TriggerSync)
+
+	//有用户的组织不能删除
+	if _, err := db.Table("test_rel_org").Checked().Remove(Map{"id": 1}); errors.Is(err, ErrConstraint) == false {
+		t.Errorf("restrict: got %v, want ErrConstraint", err)
+	}
+	if count := db.Table("test_rel_org").Count(); count != 2 {
+		t.Errorf("restrict count: got %v, want 2", count)
+	}
+	if _, err := db.Table("test_rel_org").Checked().Remove(Map{"id": 2}); err != nil {
+		t.Errorf("restrict without users: %v", err)
+	}
+
+	//删除用户的时候删除文章和中间表，标签不删除
+	if _, err := db.Table("test_rel_user").Checked().Remove(Map{"id": 1}); err != nil {
+		t.Fatalf("cascade: %v", err)
+	}
+	counts := map[string]float64{"test_rel_user": 2, "test_rel_post": 1, "test_rel_user_tag": 1, "test_rel_tag": 2}
+	for table, want := range counts {
+		if count := db.Table(table).Count(); count != want {
+			t.Errorf("cascade %s: got %v, want %v", table, count, want)
+		}
+	}
+	if names := removed.names(); len(names) != 2 {
+		t.Errorf("cascade events: got %v, want 2", names)
+	}
+}
+
+func TestRelationChecking(t *testing.T) {
+	tests := []struct {
+		name   string
+		relate Relate
+		ok     bool
+	}{
+		{"belongs", Relate{Type: RelateBelongs, Table: "t", Field: "t_id"}, true},
+		{"belongs without field", Relate{Type: RelateBelongs, Table: "t"}, false},
+		{"many", Relate{Type: RelateMany, Table: "t", Key: "p_id", Status: RelateCascade}, true},
+		{"many without key", Relate{Type: RelateMany, Table: "t"}, false},
+		{"manymany", Relate{Type: RelateManyMany, Table: "t", Through: "pt", Field: "p_id", Key: "t_id"}, true},
+		{"manymany without through", Relate{Type: RelateManyMany, Table: "t", Field: "p_id", Key: "t_id"}, false},
+		{"no table", Relate{Type: RelateMany, Key: "p_id"}, false},
+		{"unknown type", Relate{Type: "one", Table: "t", Key: "p_id"}, false},
+		{"unknown status", Relate{Type: RelateMany, Table: "t", Key: "p_id", Status: "nullify"}, false},
+	}
+
+	for _, test := range tests {
+		err := relateChecking("test_rel_check", Table{Relates: map[string]Relate{"rel": test.relate}})
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("invalid relation should panic on registration")
+		}
+	}()
+	module.Table("test_rel_check", Table{Relates: map[string]Relate{
+		"rel": {Type: RelateMany, Table: "t"},
+	}}, true)
+}
@@ -0,0 +1,126 @@
+package data
+
+import (
+	"sync/atomic"
+	"time"
+
+	. "github.com/chefsgo/base"
+)
+
+// 只读副本
+// Config.Replicas 配置副本的连接地址，Config.Routing 配置选择副本的策略
+// 视图、模型和表的查询走副本，写入和事务中的所有操作走主库
+// 查询参数里加上 UsePrimary 强制走主库
+
+const (
+	// RoutingRoundRobin 轮询
+	RoutingRoundRobin = "roundrobin"
+	// RoutingWorkload 选择 Health.Workload 最小的
+	RoutingWorkload = "workload"
+	// RoutingLag 排除延迟超过 setting 里 maxlag 的，再选择负载最小的
+	// maxlag 数字为毫秒，也可以是 "2s" 这样的字符串，都超过的话走主库
+	RoutingLag = "lag"
+
+	defaultMaxLag = 1000
+)
+
+var (
+	// UsePrimary 查询强制走主库
+	UsePrimary = routeScope("primary")
+)
+
+type (
+	routeScope string
+
+	// replicaRouter 副本选择
+	replicaRouter struct {
+		routing  string
+		maxLag   time.Duration
+		replicas []Connect
+		counter  uint64
+	}
+)
+
+// replicating 连接所有的副本
+func (this *Module) replicating(name string, config Config, driver Driver) *replicaRouter {
+	if len(config.Replicas) == 0 {
+		return nil
+	}
+
+	router := &replicaRouter{
+		routing: config.Routing,
+		maxLag:  time.Millisecond * defaultMaxLag,
+	}
+	if vv, ok := settingDuration(config.Setting, "maxlag", time.Millisecond); ok {
+		router.maxLag = vv
+	}
+
+	for _, url := range config.Replicas {
+		cfg := config
+		cfg.Url, cfg.Replicas = url, nil
+
+		connect, err := driver.Connect(name, cfg)
+		if err != nil {
+			panic("Failed to connect to data replica: " + err.Error())
+		}
+		if err := connect.Open(); err != nil {
+			panic("Failed to open data replica: " + err.Error())
+		}
+		router.replicas = append(router.replicas, connect)
+	}
+
+	return router
+}
+
+// pick 选择副本，返回nil表示走主库
+func (this *replicaRouter) pick() Connect {
+	if this == nil || len(this.replicas) == 0 {
+		return nil
+	}
+
+	switch this.routing {
+	case RoutingWorkload, RoutingLag:
+		var picked Connect
+		workload := int64(-1)
+		for _, replica := range this.replicas {
+			health, err := replica.Health()
+			if err != nil {
+				continue
+			}
+			if this.routing == RoutingLag && health.Lag > this.maxLag {
+				continue
+			}
+			if workload < 0 || health.Workload < workload {
+				picked, workload = replica, health.Workload
+			}
+		}
+		return picked
+	}
+
+	index := atomic.AddUint64(&this.counter, 1)
+	return this.replicas[int(index%uint64(len(this.replicas)))]
+}
+
+// close 关闭所有副本
+func (this *replicaRouter) close() {
+	if this == nil {
+		return
+	}
+	for _, replica := range this.replicas {
+		replica.Close()
+	}
+}
+
+// routeScoping 去掉 UsePrimary，返回是否强制走主库
+func routeScoping(args []Any) ([]Any, bool) {
+	primary := false
+	items := []Any{}
+	for _, arg := range args {
+		if arg == UsePrimary {
+			primary = true
+		} else {
+			items = append(items, arg)
+		}
+	}
+	return items, primary
+}
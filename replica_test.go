@@ -0,0 +1,108 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/chefsgo/base"
+)
+
+func init() {
+	memoryConfigs["memory_replica"] = Config{Driver: "memory", Replicas: []string{"replica"}}
+}
+
+// replicaTesting 测试用的副本，只实现 Health
+type replicaTesting struct {
+	Connect
+	name   string
+	health Health
+}
+
+func (this *replicaTesting) Health() (Health, error) {
+	return this.health, nil
+}
+
+func TestReplicaReading(t *testing.T) {
+	db := memoryTesting(t, "memory_replica")
+	memorySeed(t, db, "test_replica", Map{"name": "a"})
+	table := db.Table("test_replica")
+
+	//内存的副本是单独的存储，主库写入的在副本里查不到
+	if count := table.Count(); count != 0 {
+		t.Errorf("replica count: got %v, want 0", count)
+	}
+	if count := table.Count(UsePrimary); count != 1 {
+		t.Errorf("primary count: got %v, want 1", count)
+	}
+	if rows := table.Query(UsePrimary, Map{"name": "a"}); len(rows) != 1 {
+		t.Errorf("primary query: got %v", rows)
+	}
+
+	db.Begin()
+	if count := table.Count(); count != 1 {
+		t.Errorf("transaction count: got %v, want 1", count)
+	}
+	db.Cancel()
+}
+
+func TestReplicaPick(t *testing.T) {
+	fast := &replicaTesting{name: "fast", health: Health{Workload: 5}}
+	idle := &replicaTesting{name: "idle", health: Health{Workload: 1, Lag: time.Second * 2}}
+	busy := &replicaTesting{name: "busy", health: Health{Workload: 9, Lag: time.Second * 3}}
+
+	tests := []struct {
+		name     string
+		routing  string
+		replicas []Connect
+		want     []string
+	}{
+		{"roundrobin", RoutingRoundRobin, []Connect{fast, idle}, []string{"idle", "fast", "idle"}},
+		{"workload", RoutingWorkload, []Connect{fast, idle, busy}, []string{"idle", "idle"}},
+		{"lag", RoutingLag, []Connect{busy, fast, idle}, []string{"fast", "fast"}},
+		{"all lagging", RoutingLag, []Connect{busy, idle}, []string{"", ""}},
+	}
+
+	for _, test := range tests {
+		router := &replicaRouter{routing: test.routing, maxLag: time.Second, replicas: test.replicas}
+		for i, want := range test.want {
+			name := ""
+			if picked := router.pick(); picked != nil {
+				name = picked.(*replicaTesting).name
+			}
+			if name != want {
+				t.Errorf("%s #%d: got %q, want %q", test.name, i, name, want)
+			}
+		}
+	}
+}
+
+func TestSettingDuration(t *testing.T) {
+	tests := []struct {
+		value Any
+		want  time.Duration
+		ok    bool
+	}{
+		{"2s", time.Second * 2, true},
+		{"bad", 0, false},
+		{5, time.Millisecond * 5, true},
+		{int64(5), time.Millisecond * 5, true},
+		{1.5, time.Microsecond * 1500, true},
+		{time.Minute, time.Minute, true},
+		{nil, 0, false},
+	}
+
+	for _, test := range tests {
+		got, ok := settingDuration(Map{"maxlag": test.value}, "maxlag", time.Millisecond)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%#v: got %v %v, want %v %v", test.value, got, ok, test.want, test.ok)
+		}
+	}
+
+	router := module.replicating("test_replica_lag", Config{
+		Driver: "memory", Replicas: []string{"replica"}, Setting: Map{"maxlag": "2s"},
+	}, module.drivers["memory"])
+	defer router.close()
+	if router.maxLag != time.Second*2 {
+		t.Errorf("maxlag: got %v, want 2s", router.maxLag)
+	}
+}
@@ -0,0 +1,279 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 序列
+// DataBase.Serial 和 Break 交给连接配置的 SerialProvider 处理
+// Config.SerialProvider 为注册的名称，默认 table
+// table 使用驱动自己的序列表，sequence 使用数据库的序列，需要驱动实现 DataSequence
+// hilo 每次从序列表预留一批，在进程内分配，减少数据库的访问
+// snowflake 按时间、节点和计数生成，不访问数据库，key, start, step 都不起作用
+// 也可以注册自己的实现，比如基于redis的
+
+const (
+	defaultSerialProvider = "table"
+	defaultHiloBatch      = 100
+
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+)
+
+var (
+	errSerialUnsupported = errors.New("Data driver does not support sequence.")
+	errSerialProvider    = errors.New("Invalid data serial provider")
+	errSnowflakeNode     = errors.New("Invalid snowflake node, set snowflake_node 0-1023 in data setting")
+
+	// snowflakeEpoch 默认的起始时间
+	snowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+type (
+	// SerialProvider 序列的实现
+	// name 为连接名，base 为驱动的DataBase
+	SerialProvider interface {
+		Serial(name string, base DataBase, key string, start, step int64) (int64, error)
+		Break(name string, base DataBase, key string) error
+	}
+
+	// DataSequence 支持数据库序列的驱动实现
+	DataSequence interface {
+		Sequence(key string, start, step int64) (int64, error)
+		DropSequence(key string) error
+	}
+
+	// TableSerial 使用驱动的序列表，每次都访问数据库
+	TableSerial struct{}
+
+	// SequenceSerial 使用数据库的序列
+	SequenceSerial struct{}
+
+	// HiloSerial 批量预留，Batch 为每次预留的数量，默认100
+	// 预留不在当前事务中进行，事务回滚也不会重复分配，重启后未分配完的会跳过
+	HiloSerial struct {
+		Batch int64
+
+		mutex  sync.Mutex
+		blocks map[string]*hiloBlock
+	}
+	hiloBlock struct {
+		next, step, remain int64
+	}
+
+	// SnowflakeSerial 雪花算法，Node 为节点编号，0-1023
+	// Node 小于0时从连接的 setting 里 snowflake_node 读取，没有配置的连接时就报错
+	// 注册的 snowflake 就是这样，每个进程的每个连接都要配置不同的节点
+	// 41位毫秒时间，10位节点，12位计数，Epoch 为空使用2020年1月1日
+	SnowflakeSerial struct {
+		Node  int64
+		Epoch time.Time
+
+		mutex sync.Mutex
+		last  int64
+		seq   int64
+	}
+)
+
+func init() {
+	module.SerialProvider("table", &TableSerial{}, false)
+	module.SerialProvider("sequence", &SequenceSerial{}, false)
+	module.SerialProvider("hilo", &HiloSerial{Batch: defaultHiloBatch}, false)
+	module.SerialProvider("snowflake", &SnowflakeSerial{Node: -1}, false)
+}
+
+// SerialProvider 注册序列的实现
+func (this *Module) SerialProvider(name string, provider SerialProvider, override bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if provider == nil {
+		panic("Invalid data serial provider: " + name)
+	}
+
+	if override {
+		this.serials[name] = provider
+	} else {
+		if _, ok := this.serials[name]; ok == false {
+			this.serials[name] = provider
+		}
+	}
+}
+
+// serialing 连接使用的序列实现
+func (this *Module) serialing(config Config) (SerialProvider, error) {
+	name := config.SerialProvider
+	if name == "" {
+		name = defaultSerialProvider
+	}
+	if provider, ok := this.serials[name]; ok {
+		return provider, nil
+	}
+	return nil, fmt.Errorf("%w %s", errSerialProvider, name)
+}
+
+// serialChecking 检查连接的序列配置，连接时调用
+func (this *Module) serialChecking(config Config) error {
+	provider, err := this.serialing(config)
+	if err != nil {
+		return err
+	}
+	if vv, ok := provider.(*SnowflakeSerial); ok && vv.Node < 0 {
+		_, err = snowflakeNode(config)
+	}
+	return err
+}
+
+//---------------------------- table ----------------------------
+
+func (this *TableSerial) Serial(name string, base DataBase, key string, start, step int64) (int64, error) {
+	value := base.Serial(key, start, step)
+	return value, base.Erred()
+}
+func (this *TableSerial) Break(name string, base DataBase, key string) error {
+	base.Break(key)
+	return base.Erred()
+}
+
+//---------------------------- sequence ----------------------------
+
+func (this *SequenceSerial) Serial(name string, base DataBase, key string, start, step int64) (int64, error) {
+	if seq, ok := base.(DataSequence); ok {
+		return seq.Sequence(key, start, step)
+	}
+	return 0, errSerialUnsupported
+}
+func (this *SequenceSerial) Break(name string, base DataBase, key string) error {
+	if seq, ok := base.(DataSequence); ok {
+		return seq.DropSequence(key)
+	}
+	return errSerialUnsupported
+}
+
+//---------------------------- hilo ----------------------------
+
+// Serial 当前批次用完了，从序列表预留下一批
+// 序列表的值为每一批的第一个，每次增加 step*Batch
+func (this *HiloSerial) Serial(name string, base DataBase, key string, start, step int64) (int64, error) {
+	if step == 0 {
+		step = 1
+	}
+	batch := this.Batch
+	if batch <= 0 {
+		batch = defaultHiloBatch
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.blocks == nil {
+		this.blocks = map[string]*hiloBlock{}
+	}
+
+	id := name + "." + key
+	block, ok := this.blocks[id]
+	if ok == false || block.remain <= 0 || block.step != step {
+		hi, err := this.reserve(name, key, start, step*batch)
+		if err != nil {
+			return 0, err
+		}
+		block = &hiloBlock{next: hi, step: step, remain: batch}
+		this.blocks[id] = block
+	}
+
+	value := block.next
+	block.next += step
+	block.remain--
+	return value, nil
+}
+
+// Break 丢弃当前批次并删除序列
+func (this *HiloSerial) Break(name string, base DataBase, key string) error {
+	this.mutex.Lock()
+	delete(this.blocks, name+"."+key)
+	this.mutex.Unlock()
+
+	base.Break(key)
+	return base.Erred()
+}
+
+// reserve 用新的会话预留，不受当前事务影响
+func (this *HiloSerial) reserve(name string, key string, start, step int64) (int64, error) {
+	inst, err := module.instance(name)
+	if err != nil {
+		return 0, err
+	}
+
+	base := inst.connect.Base()
+	defer base.Close()
+
+	value := base.Serial(key, start, step)
+	return value, base.Erred()
+}
+
+//---------------------------- snowflake ----------------------------
+
+func (this *SnowflakeSerial) Serial(name string, base DataBase, key string, start, step int64) (int64, error) {
+	node := this.Node
+	if node < 0 {
+		inst, err := module.instance(name)
+		if err != nil {
+			return 0, err
+		}
+		if node, err = snowflakeNode(inst.config); err != nil {
+			return 0, err
+		}
+	}
+
+	epoch := this.Epoch
+	if epoch.IsZero() {
+		epoch = snowflakeEpoch
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	now := time.Since(epoch).Milliseconds()
+	//时钟回拨的，继续用上一次的时间
+	if now < this.last {
+		now = this.last
+	}
+
+	if now == this.last {
+		this.seq = (this.seq + 1) & (1<<snowflakeSeqBits - 1)
+		if this.seq == 0 {
+			//这一毫秒用完了，等下一毫秒
+			for now <= this.last {
+				time.Sleep(time.Millisecond / 10)
+				now = time.Since(epoch).Milliseconds()
+			}
+		}
+	} else {
+		this.seq = 0
+	}
+	this.last = now
+
+	node &= 1<<snowflakeNodeBits - 1
+	return now<<(snowflakeNodeBits+snowflakeSeqBits) | node<<snowflakeSeqBits | this.seq, nil
+}
+
+// Break 雪花算法没有状态需要删除
+func (this *SnowflakeSerial) Break(name string, base DataBase, key string) error {
+	return nil
+}
+
+// snowflakeNode 连接配置的节点编号
+func snowflakeNode(config Config) (int64, error) {
+	value, ok := config.Setting["snowflake_node"]
+	if ok == false {
+		return 0, errSnowflakeNode
+	}
+	node, ok := validateInt(value)
+	if ok == false || node.(int64) < 0 || node.(int64) >= 1<<snowflakeNodeBits {
+		return 0, errSnowflakeNode
+	}
+	return node.(int64), nil
+}
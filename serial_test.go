@@ -0,0 +1,115 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	. "github.com/chefsgo/base"
+)
+
+func TestSerialTable(t *testing.T) {
+	db := memoryTesting(t)
+
+	values := []int64{db.Serial("test_serial", 5, 2), db.Serial("test_serial", 5, 2), db.Serial("test_serial", 5, 2)}
+	if reflect.DeepEqual(values, []int64{5, 7, 9}) == false {
+		t.Errorf("serial: got %v", values)
+	}
+	db.Break("test_serial")
+	if value := db.Serial("test_serial", 5, 2); value != 5 {
+		t.Errorf("after break: got %d, want 5", value)
+	}
+	if err := db.Erred(); err != nil {
+		t.Errorf("erred: %v", err)
+	}
+
+	base := &moduleBase{name: "memory", config: Config{SerialProvider: "test_serial_none"}, base: db.(*moduleBase).base}
+	if value := base.Serial("test_serial", 1, 1); value != 0 || errors.Is(base.Erred(), errSerialProvider) == false {
+		t.Errorf("unknown provider: got %d", value)
+	}
+}
+
+func TestSerialSequence(t *testing.T) {
+	db := memoryTesting(t).(*moduleBase)
+	provider := &SequenceSerial{}
+
+	first, err := provider.Serial("memory", db.base, "test_serial_sequence", 1, 1)
+	second, _ := provider.Serial("memory", db.base, "test_serial_sequence", 1, 1)
+	if err != nil || first != 1 || second != 2 {
+		t.Errorf("sequence: got %d %d %v", first, second, err)
+	}
+
+	if _, err := provider.Serial("memory", &transactionTesting{}, "test_serial_sequence", 1, 1); errors.Is(err, errSerialUnsupported) == false {
+		t.Errorf("unsupported: got %v, want errSerialUnsupported", err)
+	}
+}
+
+func TestSerialHilo(t *testing.T) {
+	db := memoryTesting(t).(*moduleBase)
+
+	//两个进程各自预留，分配的不会重复
+	one, two := &HiloSerial{Batch: 10}, &HiloSerial{Batch: 10}
+	seen := map[int64]bool{}
+	for i := 0; i < 25; i++ {
+		for _, provider := range []*HiloSerial{one, two} {
+			value, err := provider.Serial("memory", db.base, "test_serial_hilo", 1, 1)
+			if err != nil {
+				t.Fatalf("hilo: %v", err)
+			}
+			if seen[value] {
+				t.Fatalf("hilo: %d allocated twice", value)
+			}
+			seen[value] = true
+		}
+	}
+
+	//每批只访问一次序列表，各分配25个要各预留3批，序列表到了51
+	if value := db.base.Serial("test_serial_hilo", 1, 1); value != 52 {
+		t.Errorf("reserved: got %d, want 52", value)
+	}
+
+	//事务回滚不会让预留的批次重复分配
+	db.Begin()
+	value, _ := one.Serial("memory", db.base, "test_serial_hilo_tx", 1, 1)
+	db.Cancel()
+	again, _ := two.Serial("memory", db.base, "test_serial_hilo_tx", 1, 1)
+	if value == again {
+		t.Errorf("rolled back: both got %d", value)
+	}
+}
+
+func TestSerialSnowflake(t *testing.T) {
+	provider := &SnowflakeSerial{Node: 5}
+
+	last := int64(0)
+	for i := 0; i < 5000; i++ {
+		value, err := provider.Serial("memory", nil, "", 0, 0)
+		if err != nil {
+			t.Fatalf("snowflake: %v", err)
+		}
+		if value <= last {
+			t.Fatalf("snowflake: %d after %d", value, last)
+		}
+		if node := value >> snowflakeSeqBits & (1<<snowflakeNodeBits - 1); node != 5 {
+			t.Fatalf("snowflake node: got %d, want 5", node)
+		}
+		last = value
+	}
+
+	tests := []struct {
+		setting Map
+		ok      bool
+	}{
+		{Map{"snowflake_node": 3}, true},
+		{Map{"snowflake_node": "12"}, true},
+		{Map{"snowflake_node": 1024}, false},
+		{Map{"snowflake_node": -1}, false},
+		{Map{}, false},
+	}
+	for _, test := range tests {
+		err := module.serialChecking(Config{SerialProvider: "snowflake", Setting: test.setting})
+		if (err == nil) != test.ok {
+			t.Errorf("%v: got %v", test.setting, err)
+		}
+	}
+}
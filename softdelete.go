@@ -0,0 +1,186 @@
+package data
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/chefsgo/base"
+)
+
+// 软删除
+// 在表的 setting 里配置 softdelete 开启
+// 字符串表示时间字段，删除时写入当前时间，为空表示未删除，true 使用默认的 deleted 字段
+// Map 表示状态字段，比如 {"field": "status", "removed": "removed", "normal": "normal"}
+// 删除时写入 removed 的值，恢复时写入 normal 的值，normal 为空的恢复为 nil
+// 开启后 Remove 只更新字段，Query/First/Count/Limit/Group/Entity 自动排除已删除的
+// 查询参数里加上 WithDeleted 包括已删除的，加上 OnlyDeleted 只返回已删除的
+// 直接写sql的查询没法加上条件，必须加上 WithDeleted，否则返回 ErrInvalidQuery
+
+const (
+	defaultSoftDelete = "deleted"
+)
+
+var (
+	errSoftDeleteRaw = errors.New("Raw sql query on soft delete table needs WithDeleted.")
+
+	// WithDeleted 查询包括已删除的数据
+	WithDeleted = deletedScope("with")
+	// OnlyDeleted 查询只返回已删除的数据
+	OnlyDeleted = deletedScope("only")
+)
+
+type (
+	deletedScope string
+
+	softDelete struct {
+		field   string
+		timed   bool
+		removed Any
+		normal  Any
+	}
+)
+
+// softDeleting 表的软删除配置
+func (this *Module) softDeleting(name string) (softDelete, bool) {
+	config, ok := this.tables[name]
+	if ok == false {
+		return softDelete{}, false
+	}
+
+	switch vv := config.Setting["softdelete"].(type) {
+	case bool:
+		if vv {
+			return softDelete{field: defaultSoftDelete, timed: true}, true
+		}
+	case string:
+		if vv != "" {
+			return softDelete{field: vv, timed: true}, true
+		}
+	case Map:
+		soft := softDelete{field: defaultSoftDelete, removed: vv["removed"], normal: vv["normal"]}
+		if field, ok := vv["field"].(string); ok && field != "" {
+			soft.field = field
+		}
+		if soft.removed == nil {
+			soft.timed = true
+		}
+		return soft, true
+	}
+
+	return softDelete{}, false
+}
+
+// softScoping 处理查询参数
+// 去掉 WithDeleted, OnlyDeleted，并给每个Map加上软删除的条件
+// Map里已经有这个字段的条件时不处理，直接写sql的没有 WithDeleted 返回错误
+func (this *Module) softScoping(name string, args []Any) ([]Any, error) {
+	scope := deletedScope("")
+	items := []Any{}
+	for _, arg := range args {
+		if vv, ok := arg.(deletedScope); ok {
+			scope = vv
+		} else {
+			items = append(items, arg)
+		}
+	}
+
+	soft, ok := this.softDeleting(name)
+	if ok == false || scope == WithDeleted {
+		return items, nil
+	}
+	if len(items) > 0 {
+		if _, ok := items[0].(string); ok {
+			return nil, erroring(ErrInvalidQuery, errSoftDeleteRaw)
+		}
+	}
+
+	var cond Any
+	if scope == OnlyDeleted {
+		if soft.timed {
+			cond = NOL
+		} else {
+			cond = soft.removed
+		}
+	} else {
+		if soft.timed {
+			cond = NIL
+		} else {
+			cond = Map{NOR: []Any{soft.removed}}
+		}
+	}
+
+	scoped := []Any{}
+	found := false
+	for _, item := range items {
+		if vv, ok := item.(Map); ok {
+			found = true
+			m := Map{}
+			for k, v := range vv {
+				m[k] = v
+			}
+			if _, ok := m[soft.field]; ok == false {
+				m[soft.field] = cond
+			}
+			scoped = append(scoped, m)
+		} else {
+			scoped = append(scoped, item)
+		}
+	}
+	if found == false {
+		scoped = append(scoped, Map{soft.field: cond})
+	}
+
+	return scoped, nil
+}
+
+// softRemoving 软删除，没有开启的直接删除
+// 返回删除前的数据
+func (this *Module) softRemoving(name string, table CheckedTable, args ...Any) (Map, error) {
+	args, err := this.softScoping(name, args)
+	if err != nil {
+		return nil, err
+	}
+	soft, ok := this.softDeleting(name)
+	if ok == false {
+		return table.Remove(args...)
+	}
+
+	item, err := table.First(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	value := soft.removed
+	if soft.timed {
+		value = time.Now()
+	}
+	if _, err := table.Change(item, Map{soft.field: value}); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// softRecovering 恢复软删除的数据，返回恢复前后的数据
+// 没有开启软删除的返回 ErrNotFound
+func (this *Module) softRecovering(name string, table CheckedTable, args ...Any) (Map, Map, error) {
+	soft, ok := this.softDeleting(name)
+	if ok == false {
+		return nil, nil, ErrNotFound
+	}
+
+	scoped, err := this.softScoping(name, append([]Any{OnlyDeleted}, args...))
+	if err != nil {
+		return nil, nil, err
+	}
+	item, err := table.First(scoped...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var value Any
+	if soft.timed == false {
+		value = soft.normal
+	}
+	after, err := table.Change(item, Map{soft.field: value})
+	return item, after, err
+}
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	. "github.com/chefsgo/base"
+)
+
+func TestSoftDelete(t *testing.T) {
+	db := memoryTesting(t)
+
+	tests := []struct {
+		name    string
+		setting Any
+		field   string
+		removed Any
+		normal  Any
+	}{
+		{"test_soft_timed", true, defaultSoftDelete, nil, nil},
+		{"test_soft_field", "removed_at", "removed_at", nil, nil},
+		{"test_soft_status", Map{"field": "status", "removed": "removed", "normal": "normal"}, "status", "removed", "normal"},
+	}
+
+	for _, test := range tests {
+		module.Table(test.name, Table{Setting: Map{"softdelete": test.setting}}, true)
+		memorySeed(t, db, test.name, Map{"name": "a"}, Map{"name": "b"}, Map{"name": "c"})
+		recorder := triggerWatching(test.name, test.name, "", TriggerSync)
+		table := db.Table(test.name).Checked()
+
+		item, err := table.Remove(Map{"id": 1})
+		if err != nil || item["name"] != "a" {
+			t.Errorf("%s remove: got %v %v", test.name, item, err)
+			continue
+		}
+
+		raw, _ := db.Table(test.name).Checked().Query(WithDeleted, Map{"id": 1})
+		if len(raw) != 1 {
+			t.Fatalf("%s: removed row is gone", test.name)
+		}
+		if test.removed != nil && raw[0][test.field] != test.removed {
+			t.Errorf("%s removed value: got %v, want %v", test.name, raw[0][test.field], test.removed)
+		}
+		if test.removed == nil && raw[0][test.field] == nil {
+			t.Errorf("%s removed value: got nil, want time", test.name)
+		}
+
+		if count, _ := table.Count(); count != 2 {
+			t.Errorf("%s count: got %v, want 2", test.name, count)
+		}
+		if count, _ := table.Count(WithDeleted); count != 3 {
+			t.Errorf("%s count with deleted: got %v, want 3", test.name, count)
+		}
+		if rows, _ := table.Query(OnlyDeleted); reflect.DeepEqual(memoryIds(rows), []string{"1"}) == false {
+			t.Errorf("%s only deleted: got %v", test.name, memoryIds(rows))
+		}
+		if _, err := table.Entity(1); errors.Is(err, ErrNotFound) == false {
+			t.Errorf("%s entity: got %v, want ErrNotFound", test.name, err)
+		}
+		if _, err := table.Query("name = ?", "a"); errors.Is(err, ErrInvalidQuery) == false {
+			t.Errorf("%s raw: got %v, want ErrInvalidQuery", test.name, err)
+		}
+
+		after, err := table.Recover(Map{"id": 1})
+		if err != nil || after[test.field] != test.normal {
+			t.Errorf("%s recover: got %v %v", test.name, after, err)
+		}
+		if count, _ := table.Count(); count != 3 {
+			t.Errorf("%s count after recover: got %v, want 3", test.name, count)
+		}
+		if _, err := table.Recover(Map{"id": 1}); errors.Is(err, ErrNotFound) == false {
+			t.Errorf("%s recover again: got %v, want ErrNotFound", test.name, err)
+		}
+
+		if names := recorder.names(); reflect.DeepEqual(names, []string{RemoveTrigger, RecoverTrigger}) == false {
+			t.Errorf("%s events: got %v", test.name, names)
+		}
+	}
+}
+
+func TestSoftDeleteDisabled(t *testing.T) {
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_soft_none", Map{"name": "a"})
+	table := db.Table("test_soft_none").Checked()
+
+	if _, err := table.Remove(Map{"id": 1}); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if count, _ := table.Count(WithDeleted); count != 0 {
+		t.Errorf("count: got %v, want 0", count)
+	}
+	if _, err := table.Recover(Map{"id": 1}); errors.Is(err, ErrNotFound) == false {
+		t.Errorf("recover: got %v, want ErrNotFound", err)
+	}
+}
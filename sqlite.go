@@ -0,0 +1,1211 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/chefsgo/base"
+)
+
+// sqlite驱动，基于 database/sql，不需要服务端
+// 底层的 sql 驱动需要应用自行引入，比如 _ "github.com/mattn/go-sqlite3"
+// 默认使用 sqlite3 驱动名，可以在 setting 里用 driver 修改
+// sqlite 默认不检查外键，sqlite3(mattn) 和 sqlite(modernc) 驱动会在连接串上打开外键约束
+// 其它驱动请自行在连接串里打开，setting 里 foreign_keys 为 false 时不处理
+// 直接写的sql只转换 $field$ 的字段名，->> @> ANY 这些postgres的写法不转换，请按sqlite的语法写
+// Serial 使用 RETURNING，需要 sqlite 3.35 及以上的版本
+func init() {
+	module.Driver("sqlite", &sqliteDriver{}, false)
+}
+
+var (
+	errSqliteNotOpened = errors.New("Sqlite connection not opened.")
+	errSqliteNoTx      = errors.New("Sqlite transaction not began.")
+	errSqliteVersion   = errors.New("Sqlite serial needs sqlite 3.35 or later.")
+
+	//直接写的sql里的字段名
+	sqliteField = regexp.MustCompile(`\$([A-Za-z0-9_]+)\$`)
+
+	//读出来是文本的时间，按 mattn 驱动的格式依次尝试
+	sqliteTimeLayouts = []string{
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02T15:04:05.999999999-07:00",
+		"2006-01-02 15:04:05.999999999 -0700 MST",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04",
+		"2006-01-02T15:04",
+		"2006-01-02",
+	}
+)
+
+type (
+	sqliteDriver  struct{}
+	sqliteConnect struct {
+		name   string
+		config Config
+		driver string
+		db     *sql.DB
+
+		//序列表是否已经创建
+		mutex    sync.Mutex
+		serialed bool
+	}
+	sqliteBase struct {
+		connect   *sqliteConnect
+		dialect   Dialect
+		ctx       context.Context
+		tx        *sql.Tx
+		depth     int
+		lastError error
+	}
+	sqliteTable struct {
+		base   *sqliteBase
+		name   string
+		schema string
+		source string
+		key    string
+		fields Vars
+	}
+	sqliteView struct {
+		sqliteTable
+	}
+	sqliteModel struct {
+		sqliteTable
+	}
+
+	// sqliteConn sql.DB 和 sql.Tx 的公共方法
+	sqliteConn interface {
+		ExecContext(ctx context.Context, query string, args ...Any) (sql.Result, error)
+		QueryContext(ctx context.Context, query string, args ...Any) (*sql.Rows, error)
+		QueryRowContext(ctx context.Context, query string, args ...Any) *sql.Row
+	}
+	// sqliteExecutor 带上下文执行
+	sqliteExecutor struct {
+		ctx  context.Context
+		conn sqliteConn
+	}
+)
+
+// Connect 连接
+func (driver *sqliteDriver) Connect(name string, config Config) (Connect, error) {
+	if config.Url == "" {
+		return nil, errors.New("Invalid sqlite url.")
+	}
+
+	connect := &sqliteConnect{
+		name: name, config: config, driver: "sqlite3",
+	}
+	if vv, ok := config.Setting["driver"].(string); ok && vv != "" {
+		connect.driver = vv
+	}
+
+	return connect, nil
+}
+
+// Open 打开连接
+func (this *sqliteConnect) Open() error {
+	db, err := sql.Open(this.driver, this.foreigning(this.config.Url))
+	if err != nil {
+		return err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return err
+	}
+
+	this.db = db
+	return nil
+}
+
+// foreigning 打开外键约束
+// 外键约束要在每个连接上打开，连接池没有连接时的回调，只能按驱动加上连接串的参数
+func (this *sqliteConnect) foreigning(url string) string {
+	if vv, ok := this.config.Setting["foreign_keys"].(bool); ok && vv == false {
+		return url
+	}
+
+	param := ""
+	switch this.driver {
+	case "sqlite3":
+		param = "_foreign_keys=1"
+	case "sqlite":
+		param = "_pragma=foreign_keys(1)"
+	default:
+		return url
+	}
+	if strings.Contains(url, "foreign_keys") {
+		return url
+	}
+	if strings.Contains(url, "?") {
+		return url + "&" + param
+	}
+	return url + "?" + param
+}
+
+// Health 运行状态
+func (this *sqliteConnect) Health() (Health, error) {
+	if this.db == nil {
+		return Health{}, errSqliteNotOpened
+	}
+	return Health{Workload: int64(this.db.Stats().InUse)}, nil
+}
+
+// Close 关闭连接
+func (this *sqliteConnect) Close() error {
+	if this.db != nil {
+		return this.db.Close()
+	}
+	return nil
+}
+
+func (this *sqliteConnect) Base() DataBase {
+	return &sqliteBase{connect: this, dialect: module.DialectConfig("sqlite")}
+}
+
+//---------------------------- base ----------------------------
+
+func (this *sqliteBase) Close() error {
+	//未提交的事务自动回滚，包括所有的保存点
+	if this.tx != nil {
+		err := this.tx.Rollback()
+		this.tx, this.depth = nil, 0
+		return err
+	}
+	return nil
+}
+func (this *sqliteBase) Erred() error {
+	err := this.lastError
+	this.lastError = nil
+	return err
+}
+
+func (this *sqliteBase) Table(name string) DataTable {
+	module.mutex.RLock()
+	defer module.mutex.RUnlock()
+
+	table := &sqliteTable{base: this, name: name, source: name, key: "id"}
+	if config, ok := module.tables[name]; ok {
+		table.schema = config.Schema
+		if config.Table != "" {
+			table.source = config.Table
+		}
+		if config.Key != "" {
+			table.key = config.Key
+		}
+		table.fields = config.Fields
+	}
+	return &checkedTable{table, &this.lastError}
+}
+func (this *sqliteBase) View(name string) DataView {
+	module.mutex.RLock()
+	defer module.mutex.RUnlock()
+
+	view := &sqliteView{sqliteTable{base: this, name: name, source: name, key: "id"}}
+	if config, ok := module.views[name]; ok {
+		view.schema = config.Schema
+		if config.View != "" {
+			view.source = config.View
+		}
+		if config.Key != "" {
+			view.key = config.Key
+		}
+		view.fields = config.Fields
+	}
+	return &checkedView{view, &this.lastError}
+}
+func (this *sqliteBase) Model(name string) DataModel {
+	module.mutex.RLock()
+	defer module.mutex.RUnlock()
+
+	model := &sqliteModel{sqliteTable{base: this, name: name, source: name, key: "id"}}
+	if config, ok := module.models[name]; ok {
+		if config.Model != "" {
+			model.source = config.Model
+		}
+		if config.Key != "" {
+			model.key = config.Key
+		}
+		model.fields = config.Fields
+	}
+	return &checkedModel{model, &this.lastError}
+}
+
+// Serial 序列，保存在 Config.Serial 指定的表里，表不存在会自动创建
+func (this *sqliteBase) Serial(key string, start, step int64) int64 {
+	exec, done, err := this.executor()
+	if err != nil {
+		this.lastError = err
+		return 0
+	}
+	defer done()
+
+	if step == 0 {
+		step = 1
+	}
+
+	table, err := this.serialing(exec)
+	if err != nil {
+		this.lastError = err
+		return 0
+	}
+
+	sql := fmt.Sprintf(
+		`INSERT INTO %s ("key","seq") VALUES (?,?) ON CONFLICT("key") DO UPDATE SET "seq"="seq"+? RETURNING "seq"`,
+		table,
+	)
+
+	value := int64(0)
+	if err := exec.QueryRow(sql, key, start, step).Scan(&value); err != nil {
+		this.lastError = sqliteError(err)
+		return 0
+	}
+	return value
+}
+
+// Break 删除序列
+func (this *sqliteBase) Break(key string) {
+	exec, done, err := this.executor()
+	if err != nil {
+		this.lastError = err
+		return
+	}
+	defer done()
+
+	table, err := this.serialing(exec)
+	if err != nil {
+		this.lastError = err
+		return
+	}
+
+	sql := fmt.Sprintf(`DELETE FROM %s WHERE "key"=?`, table)
+	if _, err := exec.Exec(sql, key); err != nil {
+		this.lastError = sqliteError(err)
+	}
+}
+
+// serialing 序列表名，每个连接第一次使用时创建
+func (this *sqliteBase) serialing(exec *sqliteExecutor) (string, error) {
+	name := this.connect.config.Serial
+	if name == "" {
+		name = "serial"
+	}
+	table := this.dialect.Quote(name)
+
+	this.connect.mutex.Lock()
+	defer this.connect.mutex.Unlock()
+
+	if this.connect.serialed == false {
+		version := ""
+		if err := exec.QueryRow(`SELECT sqlite_version()`).Scan(&version); err != nil {
+			return "", sqliteError(err)
+		}
+		if sqliteVersion(version) < 3035000 {
+			return "", fmt.Errorf("%w Current version is %s.", errSqliteVersion, version)
+		}
+
+		sql := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s ("key" TEXT PRIMARY KEY,"seq" INTEGER NOT NULL)`, table)
+		if _, err := exec.Exec(sql); err != nil {
+			return "", sqliteError(err)
+		}
+		this.connect.serialed = true
+	}
+	return table, nil
+}
+
+// Begin 开启事务
+func (this *sqliteBase) Begin() (*sql.Tx, error) {
+	return this.begin(nil)
+}
+
+// Transaction 在事务中执行，支持隔离级别和只读
+func (this *sqliteBase) Transaction(call func(DataBase) error, opts ...TxOption) error {
+	begin := func(opt TxOption) error {
+		_, err := this.begin(&sql.TxOptions{Isolation: opt.Isolation, ReadOnly: opt.ReadOnly})
+		return err
+	}
+	return module.transaction(this, begin, call, opts...)
+}
+
+// begin 按选项开启事务
+// 已经在事务中的创建保存点，选项只对最外层有效
+func (this *sqliteBase) begin(opts *sql.TxOptions) (*sql.Tx, error) {
+	if this.connect.db == nil {
+		return nil, errSqliteNotOpened
+	}
+	if this.tx != nil {
+		if err := this.savepoint("SAVEPOINT %s", this.depth+1); err != nil {
+			this.lastError = err
+			return nil, err
+		}
+		this.depth++
+		return this.tx, nil
+	}
+
+	//事务不能用带超时的上下文，超时取消后事务会被回滚
+	tx, err := this.connect.db.BeginTx(this.context(), opts)
+	if err != nil {
+		err = sqliteError(err)
+		this.lastError = err
+		return nil, err
+	}
+	this.tx, this.depth = tx, 1
+	return tx, nil
+}
+
+// Submit 提交事务，内层的只释放保存点
+func (this *sqliteBase) Submit() error {
+	if this.tx == nil {
+		return errSqliteNoTx
+	}
+	if this.depth > 1 {
+		//释放失败的不减层数，由 Cancel 回滚到这个保存点
+		if err := this.savepoint("RELEASE SAVEPOINT %s", this.depth); err != nil {
+			return err
+		}
+		this.depth--
+		return nil
+	}
+	err := this.tx.Commit()
+	this.tx, this.depth = nil, 0
+	return sqliteError(err)
+}
+
+// Cancel 取消事务，内层的只回滚到保存点
+func (this *sqliteBase) Cancel() error {
+	if this.tx == nil {
+		return errSqliteNoTx
+	}
+	if this.depth > 1 {
+		err := this.savepoint("ROLLBACK TO SAVEPOINT %s", this.depth)
+		if err == nil {
+			err = this.savepoint("RELEASE SAVEPOINT %s", this.depth)
+		}
+		this.depth--
+		return err
+	}
+	err := this.tx.Rollback()
+	this.tx, this.depth = nil, 0
+	return err
+}
+
+// Depth 事务的层数，0为不在事务中
+func (this *sqliteBase) Depth() int {
+	return this.depth
+}
+
+// savepoint 对保存点执行语句，保存点按层数命名
+func (this *sqliteBase) savepoint(format string, depth int) error {
+	name := this.dialect.Quote(fmt.Sprintf("sp%d", depth))
+	_, err := this.tx.ExecContext(this.context(), fmt.Sprintf(format, name))
+	return sqliteError(err)
+}
+
+// WithContext 设置上下文，用于取消和超时，返回自身
+func (this *sqliteBase) WithContext(ctx context.Context) DataBase {
+	this.ctx = ctx
+	return this
+}
+
+// context 当前的上下文
+func (this *sqliteBase) context() context.Context {
+	if this.ctx != nil {
+		return this.ctx
+	}
+	return context.Background()
+}
+
+// executor 事务中使用事务，否则直接用连接
+// 配置了超时的，每次执行都带上超时，执行完要调用 done
+func (this *sqliteBase) executor() (*sqliteExecutor, context.CancelFunc, error) {
+	var conn sqliteConn
+	if this.tx != nil {
+		conn = this.tx
+	} else if this.connect.db != nil {
+		conn = this.connect.db
+	} else {
+		return nil, func() {}, erroring(ErrConnectionLost, errSqliteNotOpened)
+	}
+
+	ctx, done := module.timeouting(this.context(), this.connect.config)
+	return &sqliteExecutor{ctx, conn}, done, nil
+}
+
+func (this *sqliteExecutor) Exec(query string, args ...Any) (sql.Result, error) {
+	return this.conn.ExecContext(this.ctx, query, args...)
+}
+func (this *sqliteExecutor) Query(query string, args ...Any) (*sql.Rows, error) {
+	return this.conn.QueryContext(this.ctx, query, args...)
+}
+func (this *sqliteExecutor) QueryRow(query string, args ...Any) *sql.Row {
+	return this.conn.QueryRowContext(this.ctx, query, args...)
+}
+
+//---------------------------- migrate ----------------------------
+
+// Columns 表现有的字段名，表不存在返回nil
+func (this *sqliteBase) Columns(schema, table string) ([]string, error) {
+	columns, _, err := this.tableInfo(schema, table)
+	return columns, err
+}
+
+// Mismatches 类型和定义不一致的字段
+// sqlite 的类型只是声明，按类型亲和性比较，VARCHAR 和 TEXT 算一样的
+func (this *sqliteBase) Mismatches(config Table) ([]string, error) {
+	if config.Table == "" {
+		return nil, nil
+	}
+	_, types, err := this.tableInfo(config.Schema, config.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	mismatches := []string{}
+	for name, field := range config.Fields {
+		tp, ok := types[strings.ToLower(name)]
+		if ok == false {
+			continue
+		}
+		want := sqliteType(field)
+		if name == config.Key && field.Type == "" {
+			want = "INTEGER"
+		}
+		if sqliteAffinity(tp) != sqliteAffinity(want) {
+			mismatches = append(mismatches, name)
+		}
+	}
+	return mismatches, nil
+}
+
+// tableInfo 表现有的字段名和类型，类型的键为小写的字段名
+func (this *sqliteBase) tableInfo(schema, table string) ([]string, map[string]string, error) {
+	exec, done, err := this.executor()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer done()
+
+	pragma := "PRAGMA "
+	if schema != "" && schema != "public" {
+		pragma += this.dialect.Quote(schema) + "."
+	}
+	rows, err := exec.Query(fmt.Sprintf(`%stable_info(%s)`, pragma, this.dialect.Quote(table)))
+	if err != nil {
+		return nil, nil, sqliteError(err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	types := map[string]string{}
+	for rows.Next() {
+		var cid int
+		var name, tp string
+		var notnull, pk int
+		var dflt Any
+		if err := rows.Scan(&cid, &name, &tp, &notnull, &dflt, &pk); err != nil {
+			return nil, nil, sqliteError(err)
+		}
+		columns = append(columns, name)
+		types[strings.ToLower(name)] = tp
+	}
+	return columns, types, sqliteError(rows.Err())
+}
+
+// Indexes 表现有的索引名
+func (this *sqliteBase) Indexes(schema, table string) ([]string, error) {
+	exec, done, err := this.executor()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	pragma := "PRAGMA "
+	if schema != "" && schema != "public" {
+		pragma += this.dialect.Quote(schema) + "."
+	}
+	rows, err := exec.Query(fmt.Sprintf(`%sindex_list(%s)`, pragma, this.dialect.Quote(table)))
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+
+	names := []string{}
+	for rows.Next() {
+		values := make([]Any, len(columns))
+		pointers := make([]Any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, sqliteError(err)
+		}
+		for i, column := range columns {
+			if column == "name" {
+				names = append(names, fmt.Sprintf("%s", sqliteDecode(values[i], Var{})))
+			}
+		}
+	}
+	return names, sqliteError(rows.Err())
+}
+
+// Statements 生成建表、加字段和索引的语句
+// sqlite 加字段不能是 NOT NULL，只在建表时加上，外键也只能在建表时加上
+func (this *sqliteBase) Statements(change SchemaChange) ([]string, error) {
+	config := change.Table
+	from := this.dialect.Quote(config.Table)
+	if config.Schema != "" && config.Schema != "public" {
+		from = this.dialect.Quote(config.Schema) + "." + from
+	}
+
+	switch change.Action {
+	case SchemaCreate:
+		columns := []string{}
+		for _, field := range change.Fields {
+			column := this.dialect.Quote(field) + " " + sqliteType(config.Fields[field])
+			if field == config.Key {
+				if config.Fields[field].Type == "" {
+					column = this.dialect.Quote(field) + " INTEGER"
+				}
+				column += " PRIMARY KEY"
+			} else if config.Fields[field].Required {
+				column += " NOT NULL"
+			}
+			columns = append(columns, column)
+		}
+		for _, foreign := range config.Foreign {
+			columns = append(columns, this.foreign(foreign))
+		}
+
+		statements := []string{
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (%s)`, from, strings.Join(columns, ",")),
+		}
+		return append(statements, this.indexes(change)...), nil
+
+	case SchemaAdd:
+		statements := []string{}
+		for _, field := range change.Fields {
+			statements = append(statements, fmt.Sprintf(
+				`ALTER TABLE %s ADD COLUMN %s %s`, from, this.dialect.Quote(field), sqliteType(config.Fields[field]),
+			))
+		}
+		return statements, nil
+
+	case SchemaIndex:
+		return this.indexes(change), nil
+	}
+
+	return nil, nil
+}
+
+// indexes 建索引的语句，唯一约束也用索引实现
+func (this *sqliteBase) indexes(change SchemaChange) []string {
+	config := change.Table
+	schema := ""
+	if config.Schema != "" && config.Schema != "public" {
+		schema = this.dialect.Quote(config.Schema) + "."
+	}
+
+	statements := []string{}
+	creating := func(index Index, unique string) {
+		fields := []string{}
+		for _, field := range index.Fields {
+			fields = append(fields, this.dialect.Quote(field))
+		}
+		statements = append(statements, fmt.Sprintf(
+			`CREATE %sINDEX IF NOT EXISTS %s%s ON %s (%s)`,
+			unique, schema, this.dialect.Quote(index.Name), this.dialect.Quote(config.Table), strings.Join(fields, ","),
+		))
+	}
+	for _, index := range change.Uniques {
+		creating(index, "UNIQUE ")
+	}
+	for _, index := range change.Indexes {
+		creating(index, "")
+	}
+	return statements
+}
+
+// foreign 建表时的外键定义
+func (this *sqliteBase) foreign(foreign Foreign) string {
+	fields, keys := []string{}, []string{}
+	for _, field := range foreign.Fields {
+		fields = append(fields, this.dialect.Quote(field))
+	}
+	for _, key := range foreign.Keys {
+		keys = append(keys, this.dialect.Quote(key))
+	}
+
+	table := foreign.Table
+	if config, ok := module.tables[table]; ok {
+		if config.Table != "" {
+			table = config.Table
+		}
+		if len(keys) == 0 && config.Key != "" {
+			keys = append(keys, this.dialect.Quote(config.Key))
+		}
+	}
+	if len(keys) == 0 {
+		keys = append(keys, this.dialect.Quote("id"))
+	}
+
+	sql := fmt.Sprintf(`FOREIGN KEY (%s) REFERENCES %s (%s)`, strings.Join(fields, ","), this.dialect.Quote(table), strings.Join(keys, ","))
+	if foreign.Name != "" {
+		sql = fmt.Sprintf(`CONSTRAINT %s %s`, this.dialect.Quote(foreign.Name), sql)
+	}
+	if foreign.OnDelete != "" {
+		sql += " ON DELETE " + strings.ToUpper(foreign.OnDelete)
+	}
+	return sql
+}
+
+// Execute 在一个事务里依次执行，已经在事务中的直接执行
+func (this *sqliteBase) Execute(statements []string) error {
+	if this.tx != nil {
+		return this.executing(statements)
+	}
+	return this.Transaction(func(DataBase) error {
+		return this.executing(statements)
+	}, TxOption{Attempts: 1})
+}
+
+func (this *sqliteBase) executing(statements []string) error {
+	exec, done, err := this.executor()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	for _, statement := range statements {
+		if _, err := exec.Exec(statement); err != nil {
+			return sqliteError(err)
+		}
+	}
+	return nil
+}
+
+// sqliteType 字段类型，主键为 INTEGER 的作为 rowid 自增
+func sqliteType(field Var) string {
+	tp := strings.ToLower(field.Type)
+	switch {
+	case tp == "int" || tp == "integer" || tp == "int64" || tp == "bool" || tp == "boolean":
+		return "INTEGER"
+	case tp == "float" || tp == "number" || tp == "decimal" || tp == "float64":
+		return "REAL"
+	case tp == "datetime" || tp == "timestamp" || tp == "date":
+		return "DATETIME"
+	case tp == "json" || tp == "map" || strings.HasPrefix(tp, "[") || field.Children != nil:
+		return "JSON"
+	case tp == "file" || tp == "bytes":
+		return "BLOB"
+	}
+	return "TEXT"
+}
+
+// sqliteAffinity 声明类型的亲和性，规则和 sqlite 的一样
+func sqliteAffinity(tp string) string {
+	tp = strings.ToUpper(tp)
+	switch {
+	case strings.Contains(tp, "INT"):
+		return "INTEGER"
+	case strings.Contains(tp, "CHAR"), strings.Contains(tp, "CLOB"), strings.Contains(tp, "TEXT"):
+		return "TEXT"
+	case tp == "", strings.Contains(tp, "BLOB"):
+		return "BLOB"
+	case strings.Contains(tp, "REAL"), strings.Contains(tp, "FLOA"), strings.Contains(tp, "DOUB"):
+		return "REAL"
+	}
+	return "NUMERIC"
+}
+
+//---------------------------- table ----------------------------
+
+// from 表名，带schema
+func (this *sqliteTable) from() string {
+	if this.schema != "" && this.schema != "public" {
+		return this.quote(this.schema) + "." + this.quote(this.source)
+	}
+	return this.quote(this.source)
+}
+
+// parse 按sqlite方言解析查询条件
+func (this *sqliteTable) parse(args ...Any) (string, []Any, string, error) {
+	query, err := module.ParseTree(args...)
+	if err != nil {
+		return "", nil, "", erroring(ErrInvalidQuery, err)
+	}
+	return this.render(query)
+}
+
+// render 按方言生成SQL，参数转成sqlite能保存的值
+// 直接写的sql把 $field$ 换成sqlite的字段名
+func (this *sqliteTable) render(query *Query) (string, []Any, string, error) {
+	where, params, orderBy, err := module.Render(this.base.dialect, query)
+	if err != nil {
+		return "", nil, "", erroring(ErrInvalidQuery, err)
+	}
+	if query.Raw != "" {
+		where, orderBy = this.raw(where), this.raw(orderBy)
+	}
+	for i, param := range params {
+		params[i] = sqliteEncode(param)
+	}
+	return where, params, orderBy, nil
+}
+
+// raw 转换直接写的sql里的字段名和随机排序
+func (this *sqliteTable) raw(sql string) string {
+	sql = strings.Replace(sql, RANDBY, this.base.dialect.Random(), -1)
+	return sqliteField.ReplaceAllStringFunc(sql, func(field string) string {
+		return this.quote(strings.Trim(field, DELIMS))
+	})
+}
+
+// quote 包裹字段名
+func (this *sqliteTable) quote(name string) string {
+	return this.base.dialect.Quote(name)
+}
+
+func (this *sqliteTable) Create(data Map) (Map, error) {
+	exec, done, err := this.base.executor()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	keys, tags, vals := []string{}, []string{}, []Any{}
+	for _, k := range queryKeys(data) {
+		v := data[k]
+		keys = append(keys, this.quote(k))
+		tags = append(tags, "?")
+		vals = append(vals, sqliteEncode(v))
+	}
+
+	sql := ""
+	if len(keys) > 0 {
+		sql = fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`, this.from(), strings.Join(keys, ","), strings.Join(tags, ","))
+	} else {
+		sql = fmt.Sprintf(`INSERT INTO %s DEFAULT VALUES`, this.from())
+	}
+
+	result, err := exec.Exec(sql, vals...)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+
+	if id, ok := data[this.key]; ok && id != nil {
+		return this.Entity(id)
+	}
+
+	//没有传主键的，LastInsertId 是 rowid，主键不是整数的时候和主键不一样，按 rowid 查
+	rowid, err := result.LastInsertId()
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	items, err := this.query(fmt.Sprintf(`SELECT * FROM %s WHERE rowid=?`, this.from()), rowid)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+	return items[0], nil
+}
+
+func (this *sqliteTable) Change(item Map, data Map) (Map, error) {
+	if item == nil || item[this.key] == nil {
+		return nil, errors.New("Invalid item to change.")
+	}
+
+	if _, err := this.Update(data, Map{this.key: item[this.key]}); err != nil {
+		return nil, err
+	}
+	return this.Entity(item[this.key])
+}
+
+func (this *sqliteTable) Remove(args ...Any) (Map, error) {
+	item, err := this.First(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	exec, done, err := this.base.executor()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	sql := fmt.Sprintf(`DELETE FROM %s WHERE %s=?`, this.from(), this.quote(this.key))
+	if _, err := exec.Exec(sql, item[this.key]); err != nil {
+		return nil, sqliteError(err)
+	}
+
+	return item, nil
+}
+
+// Recover 恢复软删除的数据，表没有开启软删除返回 ErrNotFound
+func (this *sqliteTable) Recover(args ...Any) (Map, error) {
+	_, item, err := module.softRecovering(this.name, this, args...)
+	return item, err
+}
+
+// Update 批量更新，返回更新的行数
+func (this *sqliteTable) Update(sets Map, args ...Any) (int64, error) {
+	exec, done, err := this.base.executor()
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	keys, vals := []string{}, []Any{}
+	for _, k := range queryKeys(sets) {
+		v := sets[k]
+		if k == INC {
+			if incs, ok := v.(Map); ok {
+				for _, field := range queryKeys(incs) {
+					step := incs[field]
+					keys = append(keys, fmt.Sprintf(`%s=%s+?`, this.quote(field), this.quote(field)))
+					vals = append(vals, step)
+				}
+			}
+			continue
+		}
+		keys = append(keys, fmt.Sprintf(`%s=?`, this.quote(k)))
+		vals = append(vals, sqliteEncode(v))
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	where, params, _, err := this.parse(args...)
+	if err != nil {
+		return 0, err
+	}
+	vals = append(vals, params...)
+
+	sql := fmt.Sprintf(`UPDATE %s SET %s WHERE %s`, this.from(), strings.Join(keys, ","), where)
+	result, err := exec.Exec(sql, vals...)
+	if err != nil {
+		return 0, sqliteError(err)
+	}
+
+	affected, _ := result.RowsAffected()
+	return affected, nil
+}
+
+// Delete 批量删除，返回删除的行数
+func (this *sqliteTable) Delete(args ...Any) (int64, error) {
+	exec, done, err := this.base.executor()
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	where, params, _, err := this.parse(args...)
+	if err != nil {
+		return 0, err
+	}
+
+	sql := fmt.Sprintf(`DELETE FROM %s WHERE %s`, this.from(), where)
+	result, err := exec.Exec(sql, params...)
+	if err != nil {
+		return 0, sqliteError(err)
+	}
+
+	affected, _ := result.RowsAffected()
+	return affected, nil
+}
+
+func (this *sqliteTable) Entity(id Any) (Map, error) {
+	return this.First(Map{this.key: id})
+}
+
+func (this *sqliteTable) Count(args ...Any) (float64, error) {
+	exec, done, err := this.base.executor()
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	where, params, _, err := this.parse(args...)
+	if err != nil {
+		return 0, err
+	}
+
+	count := float64(0)
+	sql := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, this.from(), where)
+	if err := exec.QueryRow(sql, params...).Scan(&count); err != nil {
+		return 0, sqliteError(err)
+	}
+	return count, nil
+}
+
+func (this *sqliteTable) First(args ...Any) (Map, error) {
+	where, params, orderBy, err := this.parse(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	sql := fmt.Sprintf(`SELECT * FROM %s WHERE %s %s LIMIT 1`, this.from(), where, orderBy)
+	items, err := this.query(sql, params...)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+	return items[0], nil
+}
+
+func (this *sqliteTable) Query(args ...Any) ([]Map, error) {
+	where, params, orderBy, err := this.parse(args...)
+	if err != nil {
+		return []Map{}, err
+	}
+
+	sql := fmt.Sprintf(`SELECT * FROM %s WHERE %s %s`, this.from(), where, orderBy)
+	items, err := this.query(sql, params...)
+	if err != nil {
+		return []Map{}, err
+	}
+	return items, nil
+}
+
+func (this *sqliteTable) Limit(offset, limit Any, args ...Any) (int64, []Map, error) {
+	count, err := this.Count(args...)
+	if err != nil || count == 0 {
+		return 0, []Map{}, err
+	}
+
+	query, err := module.ParsePage(offset, limit, args...)
+	if err != nil {
+		return 0, []Map{}, erroring(ErrInvalidQuery, err)
+	}
+	where, params, orderBy, err := this.render(query)
+	if err != nil {
+		return 0, []Map{}, err
+	}
+
+	//sqlite 的 LIMIT -1 表示不限制
+	size := query.Limit
+	if size == 0 {
+		size = -1
+	}
+	sql := fmt.Sprintf(`SELECT * FROM %s WHERE %s %s LIMIT ? OFFSET ?`, this.from(), where, orderBy)
+	params = append(params, size, query.Offset)
+	items, err := this.query(sql, params...)
+	if err != nil {
+		return 0, []Map{}, err
+	}
+	return int64(count), items, nil
+}
+
+// Group 分组统计，返回字段值和 $count 数量
+func (this *sqliteTable) Group(field string, args ...Any) ([]Map, error) {
+	where, params, orderBy, err := this.parse(args...)
+	if err != nil {
+		return []Map{}, err
+	}
+
+	expr := module.fieldby(this.base.dialect, ParseColumn(field))
+	sql := fmt.Sprintf(
+		`SELECT %s AS %s,COUNT(*) AS "$count" FROM %s WHERE %s GROUP BY %s %s`,
+		expr, this.quote(field), this.from(), where, expr, orderBy,
+	)
+	items, err := this.query(sql, params...)
+	if err != nil {
+		return []Map{}, err
+	}
+	return items, nil
+}
+
+// query 执行查询，返回解码后的结果
+func (this *sqliteTable) query(sql string, args ...Any) ([]Map, error) {
+	exec, done, err := this.base.executor()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	rows, err := exec.Query(sql, args...)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+
+	items := []Map{}
+	for rows.Next() {
+		values := make([]Any, len(columns))
+		pointers := make([]Any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, sqliteError(err)
+		}
+
+		item := Map{}
+		for i, column := range columns {
+			item[column] = sqliteDecode(values[i], this.fields[column])
+		}
+		items = append(items, item)
+	}
+
+	return items, sqliteError(rows.Err())
+}
+
+//---------------------------- view & model ----------------------------
+
+func (this *sqliteView) Count(args ...Any) (float64, error) {
+	return this.sqliteTable.Count(args...)
+}
+func (this *sqliteView) First(args ...Any) (Map, error) {
+	return this.sqliteTable.First(args...)
+}
+func (this *sqliteView) Query(args ...Any) ([]Map, error) {
+	return this.sqliteTable.Query(args...)
+}
+func (this *sqliteView) Limit(offset, limit Any, args ...Any) (int64, []Map, error) {
+	return this.sqliteTable.Limit(offset, limit, args...)
+}
+func (this *sqliteView) Group(field string, args ...Any) ([]Map, error) {
+	return this.sqliteTable.Group(field, args...)
+}
+
+func (this *sqliteModel) First(args ...Any) (Map, error) {
+	return this.sqliteTable.First(args...)
+}
+func (this *sqliteModel) Query(args ...Any) ([]Map, error) {
+	return this.sqliteTable.Query(args...)
+}
+
+//---------------------------- encode ----------------------------
+
+// sqliteError 把原生的错误归类
+// sqlite 的驱动大多不导出错误码，按错误信息判断
+func sqliteError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "UNIQUE constraint failed"):
+		return erroring(ErrDuplicate, err)
+	case strings.Contains(msg, "constraint failed"):
+		return erroring(ErrConstraint, err)
+	case strings.Contains(msg, "database is locked"), strings.Contains(msg, "database table is locked"):
+		return erroring(ErrDeadlock, err)
+	case strings.Contains(msg, "syntax error"), strings.Contains(msg, "no such column"),
+		strings.Contains(msg, "no such table"), strings.Contains(msg, "no such function"):
+		return erroring(ErrInvalidQuery, err)
+	}
+	return classify(err)
+}
+
+// sqliteEncode 写入前处理，Map和数组转成json文本
+func sqliteEncode(value Any) Any {
+	switch vv := value.(type) {
+	case nil, string, []byte, bool, time.Time,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return value
+	case Map, []Map, []Any:
+		bytes, err := json.Marshal(vv)
+		if err != nil {
+			return value
+		}
+		return string(bytes)
+	}
+
+	kind := reflect.ValueOf(value).Kind()
+	if kind == reflect.Slice || kind == reflect.Array || kind == reflect.Map {
+		if bytes, err := json.Marshal(value); err == nil {
+			return string(bytes)
+		}
+	}
+	return value
+}
+
+// sqliteDecode 读取后处理，按字段类型还原布尔、时间和json文本
+func sqliteDecode(value Any, field Var) Any {
+	if bytes, ok := value.([]byte); ok {
+		value = string(bytes)
+	}
+
+	tp := strings.ToLower(field.Type)
+	switch tp {
+	case "bool", "boolean":
+		switch vv := value.(type) {
+		case int64:
+			return vv != 0
+		case string:
+			if vvv, err := strconv.ParseBool(vv); err == nil {
+				return vvv
+			}
+		}
+		return value
+	case "datetime", "timestamp", "date":
+		if text, ok := value.(string); ok {
+			for _, layout := range sqliteTimeLayouts {
+				if vv, err := time.Parse(layout, text); err == nil {
+					return vv
+				}
+			}
+		}
+		return value
+	}
+
+	text, ok := value.(string)
+	if ok == false || text == "" {
+		return value
+	}
+
+	if strings.HasPrefix(tp, "[") || tp == "json" || tp == "map" || field.Children != nil {
+		var data Any
+		if err := json.Unmarshal([]byte(text), &data); err == nil {
+			switch vv := data.(type) {
+			case map[string]Any:
+				return Map(vv)
+			case []Any:
+				return vv
+			}
+			return data
+		}
+	}
+
+	return value
+}
+
+// sqliteVersion 版本号转成数字，3.35.0 为 3035000
+func sqliteVersion(version string) int {
+	number := 0
+	parts := strings.Split(version, ".")
+	for i := 0; i < 3; i++ {
+		part := 0
+		if i < len(parts) {
+			part, _ = strconv.Atoi(parts[i])
+		}
+		number = number*1000 + part
+	}
+	return number
+}
@@ -0,0 +1,216 @@
+package data
+
+import (
+	"fmt"
+	"regexp"
+
+	. "github.com/chefsgo/base"
+)
+
+// 严格模式
+// 连接或是表，视图，模型的 Setting 里 strict 为 true 时开启，表的设置优先
+// 查询的字段必须在 Fields 里，主键除外，json子字段有 Children 的要在 Children 里
+// 操作符必须是内置的或是用 Operator 注册的，其它的返回 ErrInvalidQuery
+// 直接写sql的查询不检查
+
+type (
+	// Operator 自定义操作符，用操作符做为 Map 的键，比如 Map{"name": Map{"~": "^a"}}
+	// Render 生成SQL，field 为处理好的字段，bind 绑定参数并返回占位符
+	// Match 给内存驱动使用，为nil时内存驱动不匹配任何数据
+	Operator struct {
+		Name   string                                                                       `json:"name"`
+		Text   string                                                                       `json:"text"`
+		Render func(dialect Dialect, field string, value Any, bind func(Any) string) string `json:"-"`
+		Match  func(value, opVal Any) bool                                                  `json:"-"`
+	}
+)
+
+var (
+	// strictOperators 内置的操作符
+	strictOperators = map[string]bool{
+		OpEqual: true, NE: true, GT: true, GE: true, LT: true, LE: true,
+		IN: true, NIN: true, ANY: true, CON: true, CONBY: true, OR: true, NOR: true,
+		SEARCH: true, FULLLIKE: true, LEFTLIKE: true, RIGHTLIKE: true,
+		OpLike: true, OpLeftLike: true, OpRightLike: true,
+		OpILike: true, OpILeftLike: true, OpIRightLike: true,
+		OpNull: true, OpNotNull: true,
+	}
+
+	// strictJson 没有定义 Children 的json子字段
+	// 只是限制查询的写法，json键的转义由方言处理，不依赖严格模式
+	strictJson = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+// Operator 注册操作符
+func (this *Module) Operator(name string, config Operator, override bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if config.Render == nil || strictOperators[name] {
+		panic("Invalid data operator: " + name)
+	}
+
+	if override {
+		this.operators[name] = config
+	} else {
+		if _, ok := this.operators[name]; ok == false {
+			this.operators[name] = config
+		}
+	}
+}
+
+// operator 注册的操作符
+func (this *Module) operator(name string) (Operator, bool) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	operator, ok := this.operators[name]
+	return operator, ok
+}
+
+// stricting 是否开启严格模式
+func (this *Module) stricting(config Config, name string) bool {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	setting := Map{}
+	if vv, ok := this.tables[name]; ok {
+		setting = vv.Setting
+	} else if vv, ok := this.views[name]; ok {
+		setting = vv.Setting
+	} else if vv, ok := this.models[name]; ok {
+		setting = vv.Setting
+	}
+
+	if vv, ok := setting["strict"].(bool); ok {
+		return vv
+	}
+	if vv, ok := config.Setting["strict"].(bool); ok {
+		return vv
+	}
+	return false
+}
+
+// Strict 按严格模式检查查询，name 为表，视图或模型
+func (this *Module) Strict(name string, args ...Any) error {
+	query, err := this.ParseTree(args...)
+	if err != nil {
+		return err
+	}
+	if query.Raw != "" {
+		return nil
+	}
+
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	for _, sort := range query.Sorts {
+		if sort.Random {
+			continue
+		}
+		if err := this.strictColumn(name, sort.Column); err != nil {
+			return err
+		}
+	}
+	if query.Where != nil {
+		return this.strictNode(name, query.Where)
+	}
+	return nil
+}
+
+// strictNode 检查条件，支持递归，调用的地方要先加锁
+func (this *Module) strictNode(name string, node Node) error {
+	switch vv := node.(type) {
+	case *Group:
+		for _, child := range vv.Nodes {
+			if err := this.strictNode(name, child); err != nil {
+				return err
+			}
+		}
+	case *Condition:
+		if err := this.strictColumn(name, vv.Column); err != nil {
+			return err
+		}
+		if _, ok := this.operators[vv.Op]; ok == false && strictOperators[vv.Op] == false {
+			return erroring(ErrInvalidQuery, fmt.Errorf("Invalid operator %s of %s", vv.Op, name))
+		}
+	}
+	return nil
+}
+
+// strictColumn 检查字段，调用的地方要先加锁
+func (this *Module) strictColumn(name string, column Column) error {
+	fields := this.Fields(name, nil)
+	field, ok := fields[column.Name]
+	if ok == false && column.Name != this.strictKey(name) {
+		return erroring(ErrInvalidQuery, fmt.Errorf("Invalid field %s of %s", column.Key, name))
+	}
+	if column.Json != "" {
+		if len(field.Children) > 0 {
+			if _, ok := field.Children[column.Json]; ok == false {
+				return erroring(ErrInvalidQuery, fmt.Errorf("Invalid field %s of %s", column.Key, name))
+			}
+		} else if strictJson.MatchString(column.Json) == false {
+			return erroring(ErrInvalidQuery, fmt.Errorf("Invalid field %s of %s", column.Key, name))
+		}
+	}
+	return nil
+}
+
+// strictSets 检查更新的字段，INC 检查里面的字段，调用的地方要先加锁
+func (this *Module) strictSets(name string, sets Map) error {
+	for key, value := range sets {
+		if key == INC {
+			if incs, ok := value.(Map); ok {
+				if err := this.strictSets(name, incs); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := this.strictColumn(name, Column{Key: key, Name: key}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// strictKey 主键
+func (this *Module) strictKey(name string) string {
+	if _, ok := this.tables[name]; ok {
+		return this.tableKey(name)
+	} else if vv, ok := this.views[name]; ok && vv.Key != "" {
+		return vv.Key
+	} else if vv, ok := this.models[name]; ok && vv.Key != "" {
+		return vv.Key
+	}
+	return "id"
+}
+
+// strict 开启了严格模式的，检查查询参数
+func (this *moduleBase) strict(name string, args []Any) error {
+	if module.stricting(this.config, name) == false {
+		return nil
+	}
+	return module.Strict(name, args...)
+}
+
+// stricts 开启了严格模式的，检查创建和更新的字段
+func (this *moduleBase) stricts(name string, sets Map) error {
+	if module.stricting(this.config, name) == false {
+		return nil
+	}
+	module.mutex.RLock()
+	defer module.mutex.RUnlock()
+	return module.strictSets(name, sets)
+}
+
+// strictField 开启了严格模式的，检查分组的字段
+func (this *moduleBase) strictField(name, field string) error {
+	if module.stricting(this.config, name) == false {
+		return nil
+	}
+	module.mutex.RLock()
+	defer module.mutex.RUnlock()
+	return module.strictColumn(name, ParseColumn(field))
+}
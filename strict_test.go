@@ -0,0 +1,124 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/chefsgo/base"
+)
+
+func TestStrictQuery(t *testing.T) {
+	module.Table("test_strict", Table{
+		Fields: Vars{
+			"name": Var{Type: "string"},
+			"age":  Var{Type: "int"},
+			"info": Var{Type: "json", Children: Vars{"city": Var{Type: "string"}}},
+			"meta": Var{Type: "json"},
+		},
+		Setting: Map{"strict": true},
+	}, true)
+	module.Operator("~test", Operator{
+		Render: func(dialect Dialect, field string, value Any, bind func(Any) string) string {
+			return field + " ~ " + bind(value)
+		},
+		Match: func(value, opVal Any) bool {
+			return strings.HasPrefix(fmt.Sprintf("%v", value), fmt.Sprintf("%v", opVal))
+		},
+	}, true)
+
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_strict", Map{"name": "a", "age": 1, "info": Map{"city": "bj"}})
+	table := db.Table("test_strict").Checked()
+
+	tests := []struct {
+		name string
+		args []Any
+		ok   bool
+	}{
+		{"field", []Any{Map{"name": "a"}}, true},
+		{"key", []Any{Map{"id": 1}}, true},
+		{"unknown field", []Any{Map{"nick": "a"}}, false},
+		{"sort", []Any{Map{"age": DESC}}, true},
+		{"unknown sort", []Any{Sorts{Asc("nick")}}, false},
+		{"random", []Any{Map{"name": RAND}}, true},
+		{"child", []Any{Map{"info.city": "bj"}}, true},
+		{"unknown child", []Any{Map{"info.street": "x"}}, false},
+		{"json key", []Any{Map{"meta.tag": "x"}}, true},
+		{"bad json key", []Any{Map{"meta.a'b": "x"}}, false},
+		{"operator", []Any{Map{"name": Map{"~test": "a"}}}, true},
+		{"unknown operator", []Any{Map{"name": Map{"~none": "a"}}}, false},
+		{"nested", []Any{Map{"$or": []Map{{"name": "a"}, {"nick": "b"}}}}, false},
+	}
+	for _, test := range tests {
+		_, err := table.Query(test.args...)
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if test.ok == false && errors.Is(err, ErrInvalidQuery) == false {
+			t.Errorf("%s: got %v, want ErrInvalidQuery", test.name, err)
+		}
+	}
+
+	if _, err := table.Create(Map{"name": "b", "nick": "b"}); errors.Is(err, ErrInvalidQuery) == false {
+		t.Errorf("create: got %v, want ErrInvalidQuery", err)
+	}
+	if _, err := table.Update(Map{INC: Map{"score": 1}}, Map{"id": 1}); errors.Is(err, ErrInvalidQuery) == false {
+		t.Errorf("update inc: got %v, want ErrInvalidQuery", err)
+	}
+	if _, err := table.Group("nick"); errors.Is(err, ErrInvalidQuery) == false {
+		t.Errorf("group: got %v, want ErrInvalidQuery", err)
+	}
+	if err := module.Strict("test_strict", "nick = ?", 1); err != nil {
+		t.Errorf("raw: got %v, want nil", err)
+	}
+}
+
+func TestStrictSetting(t *testing.T) {
+	module.Table("test_strict_off", Table{Setting: Map{"strict": false}}, true)
+	module.Table("test_strict_default", Table{}, true)
+	config := Config{Setting: Map{"strict": true}}
+
+	tests := []struct {
+		name   string
+		config Config
+		want   bool
+	}{
+		{"test_strict_off", config, false},
+		{"test_strict_default", config, true},
+		{"test_strict_default", Config{}, false},
+		{"test_strict", Config{}, true},
+	}
+	for _, test := range tests {
+		if got := module.stricting(test.config, test.name); got != test.want {
+			t.Errorf("%s %v: got %v, want %v", test.name, test.config.Setting, got, test.want)
+		}
+	}
+}
+
+func TestStrictConcurrent(t *testing.T) {
+	module.Table("test_strict_concurrent", Table{Fields: Vars{"name": Var{Type: "string"}}}, true)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				module.Strict("test_strict_concurrent", Map{"name": Map{"~test": "a"}})
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				module.Operator(fmt.Sprintf("~test%d", i), Operator{
+					Render: func(Dialect, string, Any, func(Any) string) string { return "" },
+				}, true)
+				module.Table(fmt.Sprintf("test_strict_concurrent_%d", i), Table{}, true)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,97 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// 事务
+// Transaction 开启事务执行，返回nil提交，返回错误或是panic的回滚
+// 死锁和序列化失败的会按退避时间重试，每次重试都会重新执行整个函数
+// 所以函数里不要有事务之外的副作用，触发器会等提交成功后才分发
+
+const (
+	defaultTxAttempts = 3
+	defaultTxBackoff  = time.Millisecond * 10
+)
+
+type (
+	// TxOption 事务选项
+	// Attempts 为最多执行的次数，默认3次，为1的不重试
+	// Backoff 为第一次重试前等待的时间，之后每次翻倍，默认10毫秒
+	TxOption struct {
+		Isolation sql.IsolationLevel
+		ReadOnly  bool
+		Attempts  int
+		Backoff   time.Duration
+	}
+)
+
+// txOption 合并默认值
+func txOption(opts ...TxOption) TxOption {
+	opt := TxOption{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Attempts <= 0 {
+		opt.Attempts = defaultTxAttempts
+	}
+	if opt.Backoff <= 0 {
+		opt.Backoff = defaultTxBackoff
+	}
+	return opt
+}
+
+// retryable 可以重试的错误
+func retryable(err error) bool {
+	return errors.Is(err, ErrDeadlock) || errors.Is(err, ErrSerialization)
+}
+
+// transaction 驱动实现 Transaction 时使用
+// begin 按选项开启事务，提交和回滚使用 base 的 Submit 和 Cancel
+func (this *Module) transaction(base DataBase, begin func(TxOption) error, call func(DataBase) error, opts ...TxOption) error {
+	opt := txOption(opts...)
+	backoff := opt.Backoff
+
+	var err error
+	for attempt := 1; attempt <= opt.Attempts; attempt++ {
+		if attempt > 1 {
+			//加上随机的抖动，避免同时重试又冲突
+			time.Sleep(backoff + time.Duration(rand.Int63n(int64(backoff)/2+1)))
+			backoff *= 2
+		}
+
+		err = this.transacting(base, begin, call, opt)
+		if err == nil || retryable(err) == false {
+			return err
+		}
+	}
+	return err
+}
+
+// transacting 执行一次事务，panic 的回滚后继续 panic
+func (this *Module) transacting(base DataBase, begin func(TxOption) error, call func(DataBase) error, opt TxOption) error {
+	if err := begin(opt); err != nil {
+		return err
+	}
+
+	done := false
+	defer func() {
+		if done == false {
+			base.Cancel()
+		}
+	}()
+
+	if err := call(base); err != nil {
+		return err
+	}
+
+	//提交失败的也要回滚，错误同样归类，死锁和序列化失败的可以重试
+	if err := base.Submit(); err != nil {
+		return classify(err)
+	}
+	done = true
+	return nil
+}
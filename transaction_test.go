@@ -0,0 +1,177 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/chefsgo/base"
+)
+
+// transactionTesting 测试用的 DataBase，只记录事务的调用
+// submits 为每次 Submit 依次返回的错误
+type transactionTesting struct {
+	DataBase
+	begins, cancels int
+	submits         []error
+}
+
+func (this *transactionTesting) Begin() (*sql.Tx, error) {
+	this.begins++
+	return nil, nil
+}
+func (this *transactionTesting) Submit() error {
+	if len(this.submits) == 0 {
+		return nil
+	}
+	err := this.submits[0]
+	this.submits = this.submits[1:]
+	return err
+}
+func (this *transactionTesting) Cancel() error {
+	this.cancels++
+	return nil
+}
+
+func TestTransactionRetry(t *testing.T) {
+	deadlock := erroring(ErrDeadlock, errors.New("deadlock detected"))
+	serialization := erroring(ErrSerialization, errors.New("could not serialize access"))
+	other := errors.New("other")
+
+	tests := []struct {
+		name     string
+		errs     []error
+		submits  []error
+		attempts int
+		calls    int
+		cancels  int
+		want     error
+	}{
+		{"commit", nil, nil, 0, 1, 0, nil},
+		{"deadlock", []error{deadlock}, nil, 0, 2, 1, nil},
+		{"serialization", []error{serialization, serialization}, nil, 0, 3, 2, nil},
+		{"exhausted", []error{deadlock, deadlock, deadlock}, nil, 0, 3, 3, ErrDeadlock},
+		{"attempts", []error{deadlock, deadlock}, nil, 2, 2, 2, ErrDeadlock},
+		{"no retry", []error{deadlock}, nil, 1, 1, 1, ErrDeadlock},
+		{"not retryable", []error{other}, nil, 0, 1, 1, other},
+		{"submit serialization", nil, []error{serialization}, 0, 2, 1, nil},
+		{"submit timeout", nil, []error{context.DeadlineExceeded}, 0, 1, 1, ErrTimeout},
+	}
+
+	for _, test := range tests {
+		base := &transactionTesting{submits: test.submits}
+		begin := func(TxOption) error {
+			base.begins++
+			return nil
+		}
+		calls := 0
+		call := func(DataBase) error {
+			calls++
+			if calls <= len(test.errs) {
+				return test.errs[calls-1]
+			}
+			return nil
+		}
+
+		err := module.transaction(base, begin, call, TxOption{Attempts: test.attempts, Backoff: time.Millisecond})
+		if errors.Is(err, test.want) == false || (test.want == nil && err != nil) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+		if calls != test.calls || base.begins != test.calls || base.cancels != test.cancels {
+			t.Errorf("%s: got %d calls %d begins %d cancels, want %d calls %d cancels",
+				test.name, calls, base.begins, base.cancels, test.calls, test.cancels)
+		}
+	}
+}
+
+func TestTransactionPanic(t *testing.T) {
+	base := &transactionTesting{}
+	begin := func(TxOption) error { return nil }
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("panic should be rethrown")
+		}
+		if base.cancels != 1 {
+			t.Errorf("cancels: got %d, want 1", base.cancels)
+		}
+	}()
+	module.transaction(base, begin, func(DataBase) error {
+		panic("failed")
+	})
+}
+
+func TestTransactionMemory(t *testing.T) {
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_transaction")
+
+	//重试的每次都从回滚后的数据开始
+	attempts := 0
+	err := db.Transaction(func(tx DataBase) error {
+		attempts++
+		tx.Table("test_transaction").Create(Map{"name": "a"})
+		if attempts < 3 {
+			return erroring(ErrSerialization, errors.New("serialization"))
+		}
+		return nil
+	}, TxOption{Backoff: time.Millisecond})
+	if err != nil || attempts != 3 {
+		t.Fatalf("got %v after %d attempts", err, attempts)
+	}
+	if count := db.Table("test_transaction").Count(); count != 1 {
+		t.Errorf("count: got %v, want 1", count)
+	}
+	if depth := db.Depth(); depth != 0 {
+		t.Errorf("depth: got %d, want 0", depth)
+	}
+
+	err = db.Transaction(func(tx DataBase) error {
+		tx.Table("test_transaction").Create(Map{"name": "b"})
+		return errors.New("failed")
+	})
+	if err == nil {
+		t.Errorf("failed transaction should return the error")
+	}
+	if count := db.Table("test_transaction").Count(); count != 1 {
+		t.Errorf("count after failure: got %v, want 1", count)
+	}
+}
+
+func TestTransactionSubmitFailure(t *testing.T) {
+	failed := errors.New("commit failed")
+	recorder := triggerWatching("test_transaction_failure", "test_transaction_failure", "", TriggerSync)
+
+	//内层释放保存点失败的，留给 Cancel 回滚这一层
+	base := &moduleBase{name: "memory", base: &transactionTesting{submits: []error{failed}}}
+	base.Begin()
+	base.Begin()
+	base.trigger(CreateTrigger, "test_transaction_failure", nil, Map{"id": 1})
+	if err := base.Submit(); err != failed || base.Depth() != 2 {
+		t.Errorf("inner: got %v at depth %d, want depth 2", err, base.Depth())
+	}
+	base.Cancel()
+	if depth, count := base.Depth(), len(base.pending); depth != 1 || count != 0 {
+		t.Errorf("inner cancel: got depth %d with %d pending", depth, count)
+	}
+
+	//最外层提交失败的，清掉所有的层和触发器
+	base.base.(*transactionTesting).submits = []error{failed}
+	base.trigger(CreateTrigger, "test_transaction_failure", nil, Map{"id": 2})
+	if err := base.Submit(); err != failed {
+		t.Errorf("outer: got %v, want %v", err, failed)
+	}
+	if depth, count := base.Depth(), len(base.pending); depth != 0 || count != 0 {
+		t.Errorf("outer: got depth %d with %d pending", depth, count)
+	}
+	if names := recorder.names(); len(names) != 0 {
+		t.Errorf("events: got %v, want none", names)
+	}
+
+	//之后的写入不在事务中，直接分发
+	base.trigger(CreateTrigger, "test_transaction_failure", nil, Map{"id": 3})
+	if names := recorder.names(); len(names) != 1 {
+		t.Errorf("events after failure: got %v, want one", names)
+	}
+}
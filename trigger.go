@@ -0,0 +1,118 @@
+package data
+
+import (
+	"sort"
+
+	. "github.com/chefsgo/base"
+)
+
+const (
+	// TriggerSync 同步执行，写入完成后直接调用
+	TriggerSync = "sync"
+	// TriggerAsync 异步执行，在新的协程里调用
+	TriggerAsync = "async"
+	// TriggerCommit 提交后执行
+	// 事务中触发的事件不管什么模式，都等最外层 Submit 成功之后才分发，Cancel 的时候丢弃
+	// 所以和同步的区别只在于语义，保留给需要明确声明的监听
+	TriggerCommit = "commit"
+)
+
+type (
+	// Watcher 触发器监听
+	// Table 为空表示所有表，Trigger 为空表示所有触发器
+	// Mode 为 TriggerSync, TriggerAsync, TriggerCommit，默认同步
+	Watcher struct {
+		Name    string      `json:"name"`
+		Text    string      `json:"text"`
+		Table   string      `json:"table"`
+		Trigger string      `json:"trigger"`
+		Mode    string      `json:"mode"`
+		Action  func(Event) `json:"-"`
+	}
+
+	// Event 触发器事件
+	// Base 为连接名，Before 和 After 分别为修改前后的数据
+	// 创建时 Before 为nil，删除时 After 为nil
+	Event struct {
+		Name   string `json:"name"`
+		Base   string `json:"base"`
+		Table  string `json:"table"`
+		Before Map    `json:"before"`
+		After  Map    `json:"after"`
+	}
+)
+
+// Watcher 注册触发器监听
+func (this *Module) Watcher(name string, config Watcher, override bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if config.Action == nil {
+		panic("Invalid data watcher: " + name)
+	}
+	if config.Mode == "" {
+		config.Mode = TriggerSync
+	}
+
+	if override {
+		this.watchers[name] = config
+	} else {
+		if _, ok := this.watchers[name]; ok == false {
+			this.watchers[name] = config
+		}
+	}
+}
+
+// watching 找到匹配的监听，按名称排序保证顺序固定
+func (this *Module) watching(event Event) []Watcher {
+	names := []string{}
+	for name, watcher := range this.watchers {
+		if watcher.Table != "" && watcher.Table != event.Table {
+			continue
+		}
+		if watcher.Trigger != "" && watcher.Trigger != event.Name {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	watchers := []Watcher{}
+	for _, name := range names {
+		watchers = append(watchers, this.watchers[name])
+	}
+	return watchers
+}
+
+// Trigger 分发事件
+func (this *Module) Trigger(event Event) {
+	for _, watcher := range this.watching(event) {
+		if watcher.Mode == TriggerAsync {
+			go watcher.Action(event)
+		} else {
+			watcher.Action(event)
+		}
+	}
+}
+
+// triggering 从 data.Trigger 接收回来的触发器
+// values 第一个为事件数据，包括 base, table, before, after
+func (this *Module) triggering(name string, values ...Map) {
+	event := Event{Name: name}
+	if len(values) > 0 {
+		value := values[0]
+		if vv, ok := value["base"].(string); ok {
+			event.Base = vv
+		}
+		if vv, ok := value["table"].(string); ok {
+			event.Table = vv
+		}
+		if vv, ok := value["before"].(Map); ok {
+			event.Before = vv
+		}
+		if vv, ok := value["after"].(Map); ok {
+			event.After = vv
+		}
+	}
+	this.Trigger(event)
+}
@@ -0,0 +1,188 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/chefsgo/base"
+)
+
+// triggerRecorder 记录收到的事件
+type triggerRecorder struct {
+	mutex  sync.Mutex
+	events []Event
+}
+
+func (this *triggerRecorder) record(event Event) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.events = append(this.events, event)
+}
+
+// names 收到的事件名，按收到的顺序
+func (this *triggerRecorder) names() []string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	names := []string{}
+	for _, event := range this.events {
+		names = append(names, event.Name)
+	}
+	return names
+}
+
+// triggerWatching 注册测试用的监听
+func triggerWatching(name, table, trigger, mode string) *triggerRecorder {
+	recorder := &triggerRecorder{}
+	module.Watcher(name, Watcher{
+		Table: table, Trigger: trigger, Mode: mode, Action: recorder.record,
+	}, true)
+	return recorder
+}
+
+func TestTriggerEvents(t *testing.T) {
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_trigger")
+	all := triggerWatching("test_trigger_all", "test_trigger", "", TriggerSync)
+	creates := triggerWatching("test_trigger_create", "test_trigger", CreateTrigger, TriggerSync)
+	others := triggerWatching("test_trigger_other", "test_trigger_other", "", TriggerSync)
+
+	table := db.Table("test_trigger")
+	item := table.Create(Map{"name": "a"})
+	after := table.Change(item, Map{"name": "b"})
+	table.Remove(Map{"id": item["id"]})
+	if err := db.Erred(); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if names := all.names(); reflect.DeepEqual(names, []string{CreateTrigger, ChangeTrigger, RemoveTrigger}) == false {
+		t.Errorf("all: got %v", names)
+	}
+	if names := creates.names(); reflect.DeepEqual(names, []string{CreateTrigger}) == false {
+		t.Errorf("creates: got %v", names)
+	}
+	if names := others.names(); len(names) != 0 {
+		t.Errorf("others: got %v, want none", names)
+	}
+
+	events := all.events
+	if events[0].Before != nil || reflect.DeepEqual(events[0].After, item) == false {
+		t.Errorf("create event: got %v", events[0])
+	}
+	if reflect.DeepEqual(events[1].Before, item) == false || reflect.DeepEqual(events[1].After, after) == false {
+		t.Errorf("change event: got %v", events[1])
+	}
+	if events[2].After != nil || events[2].Before["name"] != "b" || events[2].Base != "memory" {
+		t.Errorf("remove event: got %v", events[2])
+	}
+}
+
+func TestTriggerModes(t *testing.T) {
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_trigger_modes")
+	commits := triggerWatching("test_trigger_commit", "test_trigger_modes", "", TriggerCommit)
+
+	done := make(chan Event, 1)
+	module.Watcher("test_trigger_async", Watcher{
+		Table: "test_trigger_modes", Mode: TriggerAsync,
+		Action: func(event Event) { done <- event },
+	}, true)
+
+	db.Table("test_trigger_modes").Create(Map{"name": "a"})
+
+	//不在事务中的提交后执行的监听直接调用
+	if names := commits.names(); reflect.DeepEqual(names, []string{CreateTrigger}) == false {
+		t.Errorf("commit: got %v", names)
+	}
+	select {
+	case event := <-done:
+		if event.Name != CreateTrigger {
+			t.Errorf("async: got %v", event)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("async: no event")
+	}
+}
+
+func TestTriggerExternal(t *testing.T) {
+	recorder := triggerWatching("test_trigger_external", "test_trigger_external", "", TriggerSync)
+
+	Trigger(ChangeTrigger, Map{"base": "memory", "table": "test_trigger_external", "after": Map{"id": 1}})
+
+	if len(recorder.events) != 1 {
+		t.Fatalf("got %v, want one event", recorder.events)
+	}
+	event := recorder.events[0]
+	if event.Name != ChangeTrigger || event.Base != "memory" || reflect.DeepEqual(event.After, Map{"id": 1}) == false {
+		t.Errorf("got %v", event)
+	}
+}
+
+func TestTriggerTransaction(t *testing.T) {
+	db := memoryTesting(t)
+	memorySeed(t, db, "test_trigger_tx")
+	syncs := triggerWatching("test_trigger_tx_sync", "test_trigger_tx", "", TriggerSync)
+	asyncs := triggerWatching("test_trigger_tx_async", "test_trigger_tx", "", TriggerAsync)
+	commits := triggerWatching("test_trigger_tx_commit", "test_trigger_tx", "", TriggerCommit)
+	table := db.Table("test_trigger_tx")
+
+	db.Begin()
+	table.Create(Map{"name": "a"})
+	db.Begin()
+	table.Create(Map{"name": "b"})
+	db.Cancel()
+
+	//事务中所有模式的监听都不分发
+	for name, recorder := range map[string]*triggerRecorder{"sync": syncs, "async": asyncs, "commit": commits} {
+		if names := recorder.names(); len(names) != 0 {
+			t.Errorf("%s before submit: got %v, want none", name, names)
+		}
+	}
+
+	db.Submit()
+
+	//回滚的保存点里的事件丢弃
+	for name, recorder := range map[string]*triggerRecorder{"sync": syncs, "commit": commits} {
+		if names := recorder.names(); reflect.DeepEqual(names, []string{CreateTrigger}) == false {
+			t.Errorf("%s after submit: got %v", name, names)
+		} else if recorder.events[0].After["name"] != "a" {
+			t.Errorf("%s after submit: got %v", name, recorder.events[0])
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(asyncs.names()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if names := asyncs.names(); reflect.DeepEqual(names, []string{CreateTrigger}) == false {
+		t.Errorf("async after submit: got %v", names)
+	}
+
+	db.Begin()
+	table.Create(Map{"name": "c"})
+	db.Cancel()
+	if names := syncs.names(); len(names) != 1 {
+		t.Errorf("cancel: got %v, want one event", names)
+	}
+
+	//重试的每次都重新收集，只分发最后提交的
+	attempts := 0
+	err := db.Transaction(func(tx DataBase) error {
+		attempts++
+		tx.Table("test_trigger_tx").Create(Map{"name": "d"})
+		if attempts == 1 {
+			return erroring(ErrDeadlock, errors.New("deadlock"))
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Fatalf("retry: got %v after %d attempts", err, attempts)
+	}
+	if names := syncs.names(); len(names) != 2 || syncs.events[1].After["name"] != "d" {
+		t.Errorf("retry: got %v", syncs.events)
+	}
+	if count := table.Count(); count != 2 {
+		t.Errorf("retry count: got %v, want 2", count)
+	}
+}
@@ -0,0 +1,340 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/chefsgo/base"
+)
+
+const (
+	ReasonRequired = "required"
+	ReasonType     = "type"
+	ReasonOption   = "option"
+)
+
+type (
+	// FieldError 字段错误
+	// Field 为字段路径，子字段用.连接，比如 profile.name
+	FieldError struct {
+		Field  string `json:"field"`
+		Reason string `json:"reason"`
+		Value  Any    `json:"value,omitempty"`
+	}
+	// ValidationError 校验错误，包含所有字段的错误
+	ValidationError struct {
+		Name   string       `json:"name"`
+		Fields []FieldError `json:"fields"`
+	}
+)
+
+func (this *ValidationError) Error() string {
+	fields := []string{}
+	for _, field := range this.Fields {
+		fields = append(fields, fmt.Sprintf("%s(%s)", field.Field, field.Reason))
+	}
+	return fmt.Sprintf("Invalid data for %s: %s.", this.Name, strings.Join(fields, ", "))
+}
+
+// Is 校验错误都是 ErrValidation
+func (this *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// Validate 按表定义的字段校验数据
+// 会检查必填，转换类型，填充默认值，检查选项，子字段递归处理
+// partial 为 true 时用于修改，只处理传入的字段，不检查必填也不填充默认值
+// 不在字段定义中的值原样保留，没有注册的表直接返回
+func (this *Module) Validate(name string, value Map, partial bool) (Map, error) {
+	config, ok := this.tables[name]
+	if ok == false || config.Fields == nil {
+		return value, nil
+	}
+	if vv, ok := config.Setting["validate"].(bool); ok && vv == false {
+		return value, nil
+	}
+
+	errs := &ValidationError{Name: name}
+	result := this.validating(config.Fields, value, partial, "", errs)
+	if len(errs.Fields) > 0 {
+		return nil, errs
+	}
+	return result, nil
+}
+
+// validating 实际的校验，支持递归
+func (this *Module) validating(fields Vars, value Map, partial bool, prefix string, errs *ValidationError) Map {
+	result := Map{}
+	for k, v := range value {
+		result[k] = v
+	}
+
+	//按字段名排序，错误的顺序才是固定的
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field := fields[key]
+		path := prefix + key
+
+		val, exists := value[key]
+		if exists == false || val == nil {
+			if partial {
+				//修改时没有传的字段不处理，必填字段明确传了nil的要报错
+				if exists && field.Required {
+					errs.Fields = append(errs.Fields, FieldError{Field: path, Reason: ReasonRequired})
+				}
+				continue
+			}
+			if field.Default != nil {
+				if fn, ok := field.Default.(func() Any); ok {
+					val = fn()
+				} else {
+					val = field.Default
+				}
+			}
+			if val == nil {
+				if field.Required {
+					errs.Fields = append(errs.Fields, FieldError{Field: path, Reason: ReasonRequired})
+				}
+				continue
+			}
+		}
+
+		vv, ok := validateCoerce(field.Type, val)
+		if ok == false {
+			errs.Fields = append(errs.Fields, FieldError{Field: path, Reason: ReasonType, Value: val})
+			continue
+		}
+
+		if len(field.Options) > 0 && validateOption(field.Options, vv) == false {
+			errs.Fields = append(errs.Fields, FieldError{Field: path, Reason: ReasonOption, Value: val})
+			continue
+		}
+
+		if len(field.Children) > 0 {
+			switch child := vv.(type) {
+			case Map:
+				vv = this.validating(field.Children, child, partial, path+".", errs)
+			case []Map:
+				items := []Map{}
+				for i, item := range child {
+					items = append(items, this.validating(field.Children, item, partial, fmt.Sprintf("%s.%d.", path, i), errs))
+				}
+				vv = items
+			}
+		}
+
+		result[key] = vv
+	}
+
+	return result
+}
+
+// validateOption 检查选项，数组的每个值都要在选项里
+func validateOption(options Map, value Any) bool {
+	items := memorySlice(value)
+	if items == nil {
+		items = []Any{value}
+	}
+	for _, item := range items {
+		if _, ok := options[fmt.Sprintf("%v", item)]; ok == false {
+			return false
+		}
+	}
+	return true
+}
+
+// validateInt 转换成 int64
+// 整数直接转换，不经过 float64，大的整数比如 snowflake 的序列才不会丢失精度
+// 超出 int64 范围的和有小数的都算失败
+func validateInt(value Any) (Any, bool) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, false
+		}
+		return int64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		vv := rv.Float()
+		//2^63 转成 float64 是精确的，不能等于
+		if vv != math.Trunc(vv) || vv < math.MinInt64 || vv >= math.MaxInt64 {
+			return nil, false
+		}
+		return int64(vv), true
+	case reflect.String:
+		if num, err := strconv.ParseInt(strings.TrimSpace(rv.String()), 10, 64); err == nil {
+			return num, true
+		}
+	}
+	return nil, false
+}
+
+// validateCoerce 按类型转换值
+// 不认识的类型原样返回
+func validateCoerce(tp string, value Any) (Any, bool) {
+	tp = strings.ToLower(tp)
+	if strings.HasPrefix(tp, "[") && strings.HasSuffix(tp, "]") {
+		inner := tp[1 : len(tp)-1]
+
+		//json文本的数组
+		if text, ok := value.(string); ok {
+			var items []Any
+			if err := json.Unmarshal([]byte(text), &items); err != nil {
+				return nil, false
+			}
+			value = items
+		}
+
+		items := memorySlice(value)
+		if items == nil {
+			return nil, false
+		}
+
+		switch inner {
+		case "json", "map":
+			maps := []Map{}
+			for _, item := range items {
+				vv, ok := validateCoerce(inner, item)
+				if ok == false {
+					return nil, false
+				}
+				maps = append(maps, vv.(Map))
+			}
+			return maps, true
+		case "int", "integer", "int64":
+			ints := []int64{}
+			for _, item := range items {
+				vv, ok := validateCoerce(inner, item)
+				if ok == false {
+					return nil, false
+				}
+				ints = append(ints, vv.(int64))
+			}
+			return ints, true
+		case "float", "number", "float64", "decimal":
+			floats := []float64{}
+			for _, item := range items {
+				vv, ok := validateCoerce(inner, item)
+				if ok == false {
+					return nil, false
+				}
+				floats = append(floats, vv.(float64))
+			}
+			return floats, true
+		case "string", "text", "enum":
+			strs := []string{}
+			for _, item := range items {
+				vv, ok := validateCoerce(inner, item)
+				if ok == false {
+					return nil, false
+				}
+				strs = append(strs, vv.(string))
+			}
+			return strs, true
+		}
+		return items, true
+	}
+
+	switch tp {
+	case "string", "text", "enum":
+		switch vv := value.(type) {
+		case string:
+			return vv, true
+		case []byte:
+			return string(vv), true
+		case fmt.Stringer:
+			return vv.String(), true
+		}
+		if _, ok := memoryNumber(value); ok {
+			return fmt.Sprintf("%v", value), true
+		}
+		if vv, ok := value.(bool); ok {
+			return strconv.FormatBool(vv), true
+		}
+		return nil, false
+
+	case "int", "integer", "int64":
+		return validateInt(value)
+
+	case "float", "number", "float64", "decimal":
+		if vv, ok := memoryNumber(value); ok {
+			return vv, true
+		}
+		if vv, ok := value.(string); ok {
+			if num, err := strconv.ParseFloat(strings.TrimSpace(vv), 64); err == nil {
+				return num, true
+			}
+		}
+		return nil, false
+
+	case "bool", "boolean":
+		switch vv := value.(type) {
+		case bool:
+			return vv, true
+		case string:
+			if bv, err := strconv.ParseBool(strings.TrimSpace(vv)); err == nil {
+				return bv, true
+			}
+		}
+		if vv, ok := memoryNumber(value); ok {
+			return vv != 0, true
+		}
+		return nil, false
+
+	case "datetime", "date", "time", "timestamp":
+		switch vv := value.(type) {
+		case time.Time:
+			return vv, true
+		case string:
+			for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"} {
+				if tm, err := time.ParseInLocation(layout, strings.TrimSpace(vv), time.Local); err == nil {
+					return tm, true
+				}
+			}
+			return nil, false
+		}
+		if vv, ok := memoryNumber(value); ok {
+			return time.Unix(int64(vv), 0), true
+		}
+		return nil, false
+
+	case "json", "map":
+		switch vv := value.(type) {
+		case Map:
+			return vv, true
+		case string:
+			data := Map{}
+			if err := json.Unmarshal([]byte(vv), &data); err != nil {
+				return nil, false
+			}
+			return data, true
+		}
+		if reflect.ValueOf(value).Kind() == reflect.Map {
+			bytes, err := json.Marshal(value)
+			if err != nil {
+				return nil, false
+			}
+			data := Map{}
+			if err := json.Unmarshal(bytes, &data); err != nil {
+				return nil, false
+			}
+			return data, true
+		}
+		return nil, false
+	}
+
+	return value, true
+}
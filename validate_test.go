@@ -0,0 +1,118 @@
+package data
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/chefsgo/base"
+)
+
+func TestValidateCoerce(t *testing.T) {
+	tests := []struct {
+		tp    string
+		value Any
+		want  Any
+		ok    bool
+	}{
+		{"int", int64(9007199254740993), int64(9007199254740993), true},
+		{"int", uint64(math.MaxUint64), nil, false},
+		{"int", 1.5, nil, false},
+		{"int", float64(3), int64(3), true},
+		{"int", " 42 ", int64(42), true},
+		{"int", "4x", nil, false},
+		{"float", "1.5", 1.5, true},
+		{"bool", "true", true, true},
+		{"bool", 0, false, true},
+		{"string", 12, "12", true},
+		{"datetime", "2021-01-02", time.Date(2021, 1, 2, 0, 0, 0, 0, time.Local), true},
+		{"json", `{"a":1}`, Map{"a": float64(1)}, true},
+		{"json", "x", nil, false},
+		{"[int]", `[1,2]`, []int64{1, 2}, true},
+		{"[string]", []Any{"a", "b"}, []string{"a", "b"}, true},
+		{"[int]", []Any{"a"}, nil, false},
+		{"unknown", "x", "x", true},
+	}
+
+	for _, test := range tests {
+		got, ok := validateCoerce(test.tp, test.value)
+		if ok != test.ok {
+			t.Errorf("%s %#v: ok got %v, want %v", test.tp, test.value, ok, test.ok)
+			continue
+		}
+		if ok && reflect.DeepEqual(got, test.want) == false {
+			t.Errorf("%s %#v: got %#v, want %#v", test.tp, test.value, got, test.want)
+		}
+	}
+}
+
+func TestValidateTable(t *testing.T) {
+	db := memoryTesting(t)
+	module.Table("test_validate", Table{
+		Fields: Vars{
+			"name":   Var{Type: "string", Required: true},
+			"age":    Var{Type: "int", Default: 18},
+			"status": Var{Type: "enum", Options: Map{"on": "开", "off": "关"}},
+			"profile": Var{Type: "json", Children: Vars{
+				"city": Var{Type: "string", Required: true},
+			}},
+		},
+	}, true)
+	memorySeed(t, db, "test_validate")
+	table := db.Table("test_validate").Checked()
+
+	tests := []struct {
+		name   string
+		data   Map
+		fields []FieldError
+	}{
+		{"required", Map{"age": 1}, []FieldError{{Field: "name", Reason: ReasonRequired}}},
+		{"type", Map{"name": "a", "age": "x"}, []FieldError{{Field: "age", Reason: ReasonType, Value: "x"}}},
+		{"option", Map{"name": "a", "status": "bad"}, []FieldError{{Field: "status", Reason: ReasonOption, Value: "bad"}}},
+		{"children", Map{"name": "a", "profile": Map{}}, []FieldError{{Field: "profile.city", Reason: ReasonRequired}}},
+		{"all", Map{"age": "x", "status": "bad"}, []FieldError{
+			{Field: "age", Reason: ReasonType, Value: "x"},
+			{Field: "name", Reason: ReasonRequired},
+			{Field: "status", Reason: ReasonOption, Value: "bad"},
+		}},
+	}
+	for _, test := range tests {
+		_, err := table.Create(test.data)
+		if errors.Is(err, ErrValidation) == false {
+			t.Errorf("%s: got %v, want ErrValidation", test.name, err)
+			continue
+		}
+		var verr *ValidationError
+		if errors.As(err, &verr) == false || reflect.DeepEqual(verr.Fields, test.fields) == false {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.fields)
+		}
+	}
+
+	item, err := table.Create(Map{"name": "a", "status": "on", "profile": `{"city":"bj"}`})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if item["age"] != int64(18) || item["profile"].(Map)["city"] != "bj" {
+		t.Errorf("create: got %v", item)
+	}
+
+	//修改只校验传入的字段
+	item, err = table.Change(item, Map{"age": "30"})
+	if err != nil || item["age"] != int64(30) || item["name"] != "a" {
+		t.Errorf("change: got %v %v", item, err)
+	}
+	if _, err := table.Change(item, Map{"name": nil}); errors.Is(err, ErrValidation) == false {
+		t.Errorf("change nil required: got %v, want ErrValidation", err)
+	}
+	if _, err := table.Change(item, Map{"age": 1.5}); errors.Is(err, ErrValidation) == false {
+		t.Errorf("change type: got %v, want ErrValidation", err)
+	}
+
+	//原来的接口通过 Erred 拿到校验错误
+	db.Table("test_validate").Create(Map{})
+	if err := db.Erred(); errors.Is(err, ErrValidation) == false {
+		t.Errorf("erred: got %v, want ErrValidation", err)
+	}
+}